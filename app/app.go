@@ -1,35 +1,53 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/nlopes/slack"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/config"
 	"github.com/yonesko/slack-queue-bot/estimate"
 	"github.com/yonesko/slack-queue-bot/event"
 	"github.com/yonesko/slack-queue-bot/event/listener"
 	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/journal"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/outbox"
+	"github.com/yonesko/slack-queue-bot/preference"
 	"github.com/yonesko/slack-queue-bot/queue"
+	"github.com/yonesko/slack-queue-bot/status"
+	"github.com/yonesko/slack-queue-bot/usecase"
 	"github.com/yonesko/slack-queue-bot/usecase/impl"
 	"github.com/yonesko/slack-queue-bot/user"
+	"github.com/yonesko/slack-queue-bot/web"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
-)
-
-const (
-	thisBotUserId = "<@USMRFHHPE>" //test bot user USG0TPHGA
-	version       = "1.9.0"
+	"regexp"
 )
 
 type App struct {
-	rtm        *slack.RTM
+	rtm           *slack.RTM
+	statusMessage *StatusMessage
+	bus           *event.Bus
+	//cancel stops background work when the RTM connection is closed for good
+	cancel     context.CancelFunc
+	outbox     *gateway.OutboxGateway
+	queue      usecase.QueueService
+	replies    *replies
 	logger     *log.Logger
 	controller *Controller
+	httpServer *http.Server
+	config     config.Config
+	botMention *regexp.Regexp
 }
 
-func NewApp() *App {
+func NewApp(cfg config.Config) *App {
 	var lumberWriter = &lumberjack.Logger{
-		Filename: "slack-queue-bot.log",
+		Filename: cfg.LogFile,
 		MaxSize:  500,
 		Compress: true,
 	}
@@ -40,50 +58,129 @@ func NewApp() *App {
 		slack.OptionLog(log.New(lumberWriter, "slack_api: ", log.Lshortfile|log.LstdFlags)),
 	)
 	userRepository := user.NewRepository(slackApi)
-	slackGateway := gateway.NewSlackGateway(slackApi)
-	estimateRepository := estimate.NewRepository()
+	systemClock := clock.New()
+	outboxGateway := gateway.NewOutboxGateway(lumberWriter, gateway.NewSlackGateway(slackApi, systemClock), outbox.NewRepository(cfg.OutboxDbFile), cfg.CoalesceWindow, systemClock)
+	preferenceRepository := preference.NewRepository(cfg.PreferenceDbFile)
+	slackGateway := preference.NewNotificationGateway(outboxGateway, preferenceRepository, cfg.NotifyChannel)
+	estimateRepository := estimate.NewRepository(cfg.EstimateDbFile)
+	localizer := preference.NewLocalizer(preferenceRepository, userRepository)
+	formatter := preference.NewFormatter(localizer, userRepository)
+	broadcaster := web.NewBroadcaster()
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := buildBus(ctx, cfg, lumberWriter, estimateRepository, slackGateway, userRepository, preferenceRepository, localizer, formatter, broadcaster, systemClock)
+	queueService := impl.NewQueueService(
+		queue.NewRepository(cfg.QueueDbFile),
+		bus,
+		slackGateway,
+		localizer,
+		cfg.Queue().WaitForAck,
+		usecase.PresencePolicy(cfg.PresencePolicy),
+		systemClock,
+	)
+	outboxGateway.OnDelivered(startAckDeadline(queueService))
+	rateLimiter := newRateLimiter(lumberWriter, cfg.RateLimits, systemClock)
+	mux := http.NewServeMux()
+	web.NewDashboard(lumberWriter, queueService, userRepository, estimateRepository, broadcaster, cfg.DashboardToken, systemClock).Register(mux)
+	if cfg.AdminApiToken != "" {
+		web.NewAdminApi(lumberWriter, queueService, outboxGateway, bus, rateLimiter, cfg.AdminApiToken).Register(mux)
+	}
+	if cfg.CiWebhookToken != "" {
+		web.NewCiWebhook(lumberWriter, queueService, slackGateway, localizer, cfg.CiWebhookToken, cfg.QueueName).Register(mux)
+	}
+	var statusMessage *StatusMessage
+	if cfg.StatusChannel != "" {
+		statusMessage = NewStatusMessage(lumberWriter, cfg.StatusChannel, slackApi, status.NewRepository(cfg.StatusDbFile),
+			queueService, userRepository, estimateRepository, formatter, broadcaster.Subscribe(), systemClock)
+	}
+	botUserId := resolveBotUserId(slackApi)
+	rtm := connectToRTM(slackApi)
+	log.Printf("bot user id is %s", botUserId)
 	return &App{
-		rtm:    connectToRTM(slackApi),
-		logger: log.New(lumberWriter, "app: ", log.Lshortfile|log.LstdFlags),
-		controller: newController(
-			lumberWriter,
-			userRepository,
-			impl.NewQueueService(
-				queue.NewRepository(),
-				buildBus(lumberWriter, estimateRepository, slackGateway, userRepository),
-				slackGateway,
-			),
-			estimateRepository,
-		),
+		statusMessage: statusMessage,
+		bus:           bus,
+		cancel:        cancel,
+		outbox:        outboxGateway,
+		queue:         queueService,
+		rtm:           rtm,
+		replies:       newReplies(lumberWriter, rtm, slackApi, botUserId),
+		logger:        log.New(lumberWriter, "app: ", log.Lshortfile|log.LstdFlags),
+		controller:    newController(lumberWriter, userRepository, queueService, estimateRepository, preferenceRepository, localizer, formatter, cfg.AdminUserIds, rateLimiter, systemClock),
+		httpServer:    &http.Server{Addr: cfg.HttpAddr, Handler: mux},
+		config:        cfg,
+		botMention:    mentionRe(botUserId),
+	}
+}
+
+//startAckDeadline gives the holder time to ack since they have got their turn, not since it came
+func startAckDeadline(queueService usecase.QueueService) gateway.DeliveryListener {
+	return func(userId string, kind gateway.Kind) {
+		if kind != gateway.KindYourTurn {
+			return
+		}
+		if err := queueService.StartAckDeadline(userId); err != nil {
+			log.Printf("can't start ack deadline of %s: %s", userId, err)
+		}
 	}
 }
 
-func buildBus(lumberWriter *lumberjack.Logger, estimateRepository estimate.Repository, slackGateway gateway.Gateway, userRepository user.Repository) event.QueueChangedEventBus {
-	newHolderEventListeners := []listener.NewHolderEventListener{
-		listener.NewHoldTimeEstimateListener(estimateRepository),
+//buildBus subscribes listeners, names are their checkpoints in the journal, so they must not change
+func buildBus(ctx context.Context, cfg config.Config, lumberWriter *lumberjack.Logger, estimateRepository estimate.Repository, slackGateway gateway.Gateway, userRepository user.Repository, preferenceRepository preference.Repository, localizer preference.Localizer, formatter preference.Formatter, broadcaster *web.Broadcaster, clock clock.Clock) *event.Bus {
+	bus := event.NewQueueChangedEventBus(ctx, lumberWriter, journal.NewRepository(cfg.JournalDbFile), clock)
+	bus.Subscribe("hold-time-estimate", listener.OnNewHolder(listener.NewHoldTimeEstimateListener(estimateRepository, estimate.NewSampleRepository(cfg.HoldSampleDbFile), cfg.Queue().MinHoldTime, cfg.Queue().MaxHoldTime)), model.NewHolderEvent{})
+	bus.Subscribe("notify-watchers", listener.OnNewHolder(listener.NewNotifyWatchersListener(slackGateway, preferenceRepository, userRepository, localizer, cfg.QueueName)), model.NewHolderEvent{})
+	if cfg.UserOauthAccessToken != "" {
+		profileGateway := gateway.NewSlackProfileGateway(slack.New(cfg.UserOauthAccessToken))
+		bus.Subscribe("holder-status", listener.OnNewHolder(listener.NewHolderStatusListener(profileGateway, cfg.QueueName, cfg.Queue().MaxHoldTime, clock)), model.NewHolderEvent{})
 	}
-	newSecondEventListeners := []listener.NewSecondEventListener{
-		listener.NewNotifyNewSecondEventListener(slackGateway),
+	if execHooks := readExecHooks(cfg.ExecHooksFile); len(execHooks.Hooks) > 0 {
+		bus.Subscribe("exec-hooks", listener.OnNewHolder(listener.NewExecHookListener(lumberWriter, execHooks, slackGateway, localizer, clock)), model.NewHolderEvent{})
 	}
-	deletedEventListeners := []listener.DeletedEventListener{
-		listener.NewNotifyDeletedEventListener(slackGateway, userRepository),
+	bus.Subscribe("notify-second", listener.OnNewSecond(listener.NewNotifyNewSecondEventListener(slackGateway, localizer, usecase.PresencePolicy(cfg.PresencePolicy))), model.NewSecondEvent{})
+	bus.Subscribe("notify-deleted", listener.OnDeleted(listener.NewNotifyDeletedEventListener(slackGateway, userRepository, localizer)), model.DeletedEvent{})
+	bus.Subscribe("notify-position", listener.OnPositionChanged(listener.NewNotifyPositionListener(slackGateway, preferenceRepository, userRepository, estimateRepository, localizer, formatter, clock)), model.PositionChangedEvent{})
+	bus.Subscribe("dashboard", broadcaster)
+	if webhooks := readWebhooks(cfg.WebhooksFile); len(webhooks) > 0 {
+		bus.Subscribe("webhooks", listener.NewWebhookListener(lumberWriter, webhooks, clock))
 	}
-	return event.NewQueueChangedEventBus(lumberWriter, newHolderEventListeners, newSecondEventListeners, deletedEventListeners)
+	return bus
 }
 
 func (app *App) Run() {
+	defer app.cancel()
 	app.printOnHello()
+	go app.serveHttp()
+	go app.outbox.Run()
+	app.bus.Start()
+	if err := app.queue.Resume(); err != nil {
+		app.logger.Printf("can't resume the queue: %s", err)
+	}
+	if app.statusMessage != nil {
+		go app.statusMessage.Run()
+	}
 	for msg := range app.rtm.IncomingEvents {
 		switch ev := msg.Data.(type) {
 		case *slack.MessageEvent:
-			if !needProcess(ev) {
+			if !needProcess(ev, app.botMention) {
+				break
+			}
+			if app.replies.isAnswered(ev.Channel, ev.Timestamp) {
+				app.logger.Printf("message %s in %s is answered already", ev.Timestamp, ev.Channel)
+				break
+			}
+			responseText := app.controller.execute(ev.User, extractCommandTxt(ev.Text, app.botMention))
+			if responseText == "" {
 				break
 			}
-			responseText := app.controller.execute(extractCommand(ev))
 			app.logger.Printf("answer '%s' to %s ", responseText, ev.Channel)
-			app.rtm.SendMessage(app.rtm.NewOutgoingMessage(responseText, ev.Channel, slack.RTMsgOptionTS(ev.ThreadTimestamp)))
+			app.replies.send(ev.Channel, ev.Timestamp, ev.ThreadTimestamp, responseText)
+		case *slack.AckMessage:
+			app.replies.acked(ev.ReplyTo)
 		case *slack.OutgoingErrorEvent:
-			app.logger.Printf("Can't send msg: %s\n", ev.Error())
+			app.replies.failed(ev)
+		case *slack.ConnectedEvent:
+			if ev.ConnectionCount > 1 {
+				app.replies.reconnected()
+			}
 		}
 	}
 }
@@ -95,7 +192,39 @@ func (app *App) printOnHello() {
 		return
 	}
 	app.logger.Println(string(bytes))
-	app.logger.Printf("version %s", version)
+	app.logger.Printf("version %s", app.config.Version)
+}
+
+func (app *App) serveHttp() {
+	app.logger.Printf("serving http on %s", app.httpServer.Addr)
+	if err := app.httpServer.ListenAndServe(); err != nil {
+		app.logger.Printf("http server stopped: %s", err)
+	}
+}
+
+func readWebhooks(filename string) []listener.Webhook {
+	var webhooks []listener.Webhook
+	readJsonIfExists(filename, &webhooks)
+	return webhooks
+}
+
+func readExecHooks(filename string) listener.ExecHooksConfig {
+	execHooks := listener.ExecHooksConfig{}
+	readJsonIfExists(filename, &execHooks)
+	return execHooks
+}
+
+func readJsonIfExists(filename string, v interface{}) {
+	bytes, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("can't read %s: %s", filename, err)
+	}
+	if err := json.Unmarshal(bytes, v); err != nil {
+		log.Fatalf("can't parse %s: %s", filename, err)
+	}
 }
 
 func mustGetEnv(key string) string {
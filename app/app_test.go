@@ -1,6 +1,9 @@
 package app
 
-import "testing"
+import (
+	"github.com/nlopes/slack"
+	"testing"
+)
 
 /*
 UCPHETPTJ
@@ -15,15 +18,44 @@ func Test_extractCommand(t *testing.T) {
 		{text: "uhvbknjlm", want: "uhvbknjlm"},
 		{text: "<@USMRFHHPE> add", want: "add"},
 		{text: "<@USMRFHHPE> someCmd \t", want: "somecmd"},
+		{text: "show <@USMRFHHPE>", want: "show"},
+		{text: "hey <@USMRFHHPE|queue-bot>  show", want: "hey show"},
+		{text: "<@USMRFHHPE><@USMRFHHPE>add", want: "add"},
+		{text: "<@UOTHERBOT> add", want: "<@uotherbot> add"},
 		{text: " someCmd", want: "somecmd"},
 		{text: "add", want: "add"},
 		{text: "5434424244", want: "5434424244"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.text, func(t *testing.T) {
-			if got := extractCommandTxt(tt.text); got != tt.want {
+			if got := extractCommandTxt(tt.text, mentionRe("USMRFHHPE")); got != tt.want {
 				t.Errorf("extractCommandTxt() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func Test_needProcess(t *testing.T) {
+	mention := mentionRe("USMRFHHPE")
+	tests := []struct {
+		ev   slack.MessageEvent
+		want bool
+	}{
+		{ev: msg("C1", "<@USMRFHHPE> add"), want: true},
+		{ev: msg("C1", "please, show <@USMRFHHPE>"), want: true},
+		{ev: msg("C1", "show"), want: false},
+		{ev: msg("C1", "<@UOTHERBOT> show"), want: false},
+		{ev: msg("D1", "show"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ev.Text, func(t *testing.T) {
+			if got := needProcess(&tt.ev, mention); got != tt.want {
+				t.Errorf("needProcess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func msg(channel, text string) slack.MessageEvent {
+	return slack.MessageEvent{Msg: slack.Msg{Channel: channel, Text: text, User: "U1"}}
+}
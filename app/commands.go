@@ -0,0 +1,234 @@
+package app
+
+import (
+	"fmt"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"strings"
+)
+
+//permission tells who can run a command
+type permission int
+
+const (
+	everyone permission = iota
+	//admins are listed in admin_user_ids, everyone is an admin if the list is empty
+	admins
+)
+
+type argument struct {
+	name     string
+	optional bool
+}
+
+type handler func(c *Controller, authorUserId string, args []string) (string, error)
+
+type command struct {
+	name string
+	//aliasesLabel is a label with comma separated aliases of the command in each language
+	aliasesLabel string
+	//helpLabel describes the command in help
+	helpLabel  string
+	arguments  []argument
+	permission permission
+	//readOnly commands are rate limited separately from ones changing something
+	readOnly bool
+	handler  handler
+}
+
+//registry is every command the bot knows in order of help
+type registry []command
+
+func newRegistry() registry {
+	return registry{
+		{name: "add", aliasesLabel: "add_aliases", helpLabel: "add_help", handler: noArgs((*Controller).addUser)},
+		{name: "del", aliasesLabel: "del_aliases", helpLabel: "del_help", handler: noArgs((*Controller).deleteUser)},
+		{name: "show", aliasesLabel: "show_aliases", helpLabel: "show_help", readOnly: true, handler: noArgs((*Controller).showQueue)},
+		{name: "clean", aliasesLabel: "clean_aliases", helpLabel: "clean_help", permission: admins, handler: noArgs((*Controller).clean)},
+		{name: "pop", aliasesLabel: "pop_aliases", helpLabel: "pop_help", permission: admins, handler: noArgs((*Controller).pop)},
+		{name: "ack", aliasesLabel: "ack_aliases", helpLabel: "ack_help", handler: noArgs((*Controller).ack)},
+		{name: "pass", aliasesLabel: "pass_aliases", helpLabel: "pass_help", handler: noArgs((*Controller).pass)},
+		{
+			name: "lang", aliasesLabel: "lang_aliases", helpLabel: "lang_help",
+			arguments: []argument{{name: strings.Join(i18n.Codes(), "|")}},
+			handler: func(c *Controller, authorUserId string, args []string) (string, error) {
+				return c.lang(authorUserId, args[0])
+			},
+		},
+		{
+			name: "notify", aliasesLabel: "notify_aliases", helpLabel: "notify_help",
+			arguments: []argument{{name: "topic", optional: true}, {name: deliveriesUsage(), optional: true}},
+			handler:   (*Controller).notify,
+		},
+		{
+			name: "alert", aliasesLabel: "alert_aliases", helpLabel: "alert_help",
+			arguments: []argument{{name: "N|jump|off", optional: true}},
+			handler:   (*Controller).alert,
+		},
+		{
+			name: "watch", aliasesLabel: "watch_aliases", helpLabel: "watch_help",
+			arguments: []argument{{name: "empty|holder|both", optional: true}},
+			handler:   (*Controller).watch,
+		},
+		{name: "unwatch", aliasesLabel: "unwatch_aliases", helpLabel: "unwatch_help", handler: noArgs((*Controller).unwatch)},
+		{
+			name: "help", aliasesLabel: "help_aliases", helpLabel: "help_help", readOnly: true,
+			arguments: []argument{{name: "command", optional: true}},
+			handler: func(c *Controller, authorUserId string, args []string) (string, error) {
+				if len(args) == 0 {
+					return c.showHelp(authorUserId), nil
+				}
+				return c.showCommandHelp(authorUserId, args[0]), nil
+			},
+		},
+	}
+}
+
+func deliveriesUsage() string {
+	var deliveries []string
+	for _, d := range preference.Deliveries {
+		deliveries = append(deliveries, string(d))
+	}
+	return strings.Join(deliveries, "|")
+}
+
+func noArgs(f func(c *Controller, authorUserId string) (string, error)) handler {
+	return func(c *Controller, authorUserId string, args []string) (string, error) {
+		return f(c, authorUserId)
+	}
+}
+
+//find looks for a command by its name or alias in any language
+func (r registry) find(word string) (command, bool) {
+	for _, cmd := range r {
+		for _, w := range cmd.words() {
+			if w == word {
+				return cmd, true
+			}
+		}
+	}
+	return command{}, false
+}
+
+//suggest finds the closest name or alias to a mistyped word
+func (r registry) suggest(word string) (string, bool) {
+	best, bestDistance := "", -1
+	for _, cmd := range r {
+		for _, w := range cmd.words() {
+			d := editDistance(word, w)
+			if d > 2 || d*2 > len([]rune(w)) {
+				continue
+			}
+			if bestDistance == -1 || d < bestDistance {
+				best, bestDistance = w, d
+			}
+		}
+	}
+	return best, bestDistance != -1
+}
+
+func (cmd command) words() []string {
+	words := []string{cmd.name}
+	for _, translation := range i18n.Translations(cmd.aliasesLabel) {
+		words = append(words, splitAliases(translation)...)
+	}
+	return words
+}
+
+//aliases are the name and aliases in the language of labels
+func (cmd command) aliases(labels i18n.Labels) []string {
+	aliases := []string{cmd.name}
+	translation, _ := labels.Get(cmd.aliasesLabel)
+	for _, alias := range splitAliases(translation) {
+		if !contains(aliases, alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+func splitAliases(translation string) []string {
+	var aliases []string
+	for _, alias := range strings.Split(translation, ",") {
+		if alias = strings.ToLower(strings.TrimSpace(alias)); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+func (cmd command) acceptsArgs(n int) bool {
+	required := 0
+	for _, arg := range cmd.arguments {
+		if !arg.optional {
+			required++
+		}
+	}
+	return n >= required && n <= len(cmd.arguments)
+}
+
+//usage is like lang|язык <en|ru>
+func (cmd command) usage(labels i18n.Labels) string {
+	parts := []string{strings.Join(cmd.aliases(labels), "|")}
+	for _, arg := range cmd.arguments {
+		if arg.optional {
+			parts = append(parts, fmt.Sprintf("[%s]", arg.name))
+		} else {
+			parts = append(parts, fmt.Sprintf("<%s>", arg.name))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (cmd command) help(labels i18n.Labels) string {
+	txt := fmt.Sprintf("`%s` - %s", cmd.usage(labels), labels.MustGet(cmd.helpLabel))
+	if cmd.permission == admins {
+		txt += " " + labels.MustGet("admins_only")
+	}
+	return txt
+}
+
+//editDistance is the optimal string alignment distance, so a swap of neighbour letters costs 1
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func min(first int, rest ...int) int {
+	m := first
+	for _, v := range rest {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
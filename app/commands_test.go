@@ -0,0 +1,170 @@
+package app
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/config"
+	"github.com/yonesko/slack-queue-bot/estimate"
+	eventmock "github.com/yonesko/slack-queue-bot/event/mock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	queuemock "github.com/yonesko/slack-queue-bot/queue/mock"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"github.com/yonesko/slack-queue-bot/usecase/impl"
+	usermock "github.com/yonesko/slack-queue-bot/user/mock"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRegistry_find(t *testing.T) {
+	i18n.InitFrom("../i18n", "russian")
+	r := newRegistry()
+	cmd, ok := r.find("show")
+	assert.True(t, ok)
+	assert.Equal(t, "show", cmd.name)
+	cmd, ok = r.find("покаж")
+	assert.True(t, ok)
+	assert.Equal(t, "show", cmd.name)
+	_, ok = r.find("shwo")
+	assert.False(t, ok)
+}
+
+func TestRegistry_suggest(t *testing.T) {
+	i18n.InitFrom("../i18n", "russian")
+	r := newRegistry()
+	tests := map[string]string{
+		"shwo":  "show",
+		"clen":  "clean",
+		"pas":   "pass",
+		"поакж": "покаж",
+		"adx":   "add",
+	}
+	for typo, want := range tests {
+		got, ok := r.suggest(typo)
+		assert.True(t, ok, typo)
+		assert.Equal(t, want, got, typo)
+	}
+	_, ok := r.suggest("x")
+	assert.False(t, ok)
+	_, ok = r.suggest("deploy")
+	assert.False(t, ok)
+}
+
+func TestCommand_usage(t *testing.T) {
+	i18n.InitFrom("../i18n", "russian")
+	r := newRegistry()
+	lang, _ := r.find("lang")
+	assert.Equal(t, "lang|язык <en|ru>", lang.usage(i18n.For("russian")))
+	help, _ := r.find("help")
+	assert.Equal(t, "help [command]", help.usage(i18n.For("english")))
+	assert.True(t, help.acceptsArgs(0))
+	assert.True(t, help.acceptsArgs(1))
+	assert.False(t, help.acceptsArgs(2))
+	assert.False(t, lang.acceptsArgs(0))
+}
+
+func TestController_execute(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	c := newController(ioutil.Discard, nil, nil, nil, nil, preference.NewLocalizerMock(), nil, []string{"admin"}, newRateLimiter(ioutil.Discard, config.RateLimits{}, clock.New()), clock.New())
+	assert.Equal(t, "Did you mean `show`?", c.execute("1", "shwo"))
+	assert.Equal(t, "Usage: `lang <en|ru>`", c.execute("1", "lang"))
+	assert.Equal(t, "Only admins can do it", c.execute("1", "clean"))
+	assert.Equal(t, "`pop` - Delete the first one from the queue (admins only)", c.execute("1", "help pop"))
+}
+
+func Test_editDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("show", "show"))
+	assert.Equal(t, 1, editDistance("shwo", "show"))
+	assert.Equal(t, 1, editDistance("ad", "add"))
+	assert.Equal(t, 3, editDistance("", "add"))
+	assert.Equal(t, 1, editDistance("дел", "дал"))
+}
+
+func TestController_execute_throttled(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	limits := config.RateLimits{ReadOnly: config.RateLimit{Burst: 1, Every: time.Hour}}
+	c := newController(ioutil.Discard, nil, nil, nil, nil, preference.NewLocalizerMock(), nil, nil, newRateLimiter(ioutil.Discard, limits, clock.New()), clock.New())
+	assert.Equal(t, "`help [command]` - Show all commands or how to use one of them", c.execute("1", "help help"))
+	assert.Equal(t, "Too many commands, slow down a bit", c.execute("1", "help help"))
+	assert.Equal(t, "", c.execute("1", "shwo"))
+}
+
+func TestController_notify(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	preferences := &preference.RepositoryMock{}
+	c := newController(ioutil.Discard, nil, nil, nil, preferences, preference.NewLocalizerMock(), nil, nil, newRateLimiter(ioutil.Discard, config.RateLimits{}, clock.New()), clock.New())
+	assert.Equal(t, "`second` - you are the second: DM", c.execute("1", "notify second"))
+	assert.Equal(t, "Choose one of dm|channel|off", c.execute("1", "notify second loud"))
+	assert.Equal(t, "I don't know this topic, choose one of second|position|deleted|empty|holder", c.execute("1", "notify third"))
+	assert.Contains(t, c.execute("1", "notifications empty channel"), "`empty` - queue is empty: mention in the channel")
+	assert.Equal(t, "`holder` notifications can't be turned off, your turn would be passed to the next one before you know it came", c.execute("1", "notify holder off"))
+
+	saved, err := preferences.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, preference.DeliveryChannel, saved.Of("1").Delivery(preference.TopicEmpty))
+	assert.Equal(t, preference.DeliveryDm, saved.Of("1").Delivery(preference.TopicSecond))
+	assert.Equal(t, preference.DeliveryDm, saved.Of("1").Delivery(preference.TopicHolder))
+}
+
+func TestController_alert(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	preferences := &preference.RepositoryMock{}
+	c := newController(ioutil.Discard, nil, nil, nil, preferences, preference.NewLocalizerMock(), nil, nil, newRateLimiter(ioutil.Discard, config.RateLimits{}, clock.New()), clock.New())
+	assert.Equal(t, "No alert of a position\nNo alert when someone jumps ahead of you", c.execute("1", "alert"))
+	assert.Equal(t, "Usage: `alert <N|jump|off>`", c.execute("1", "alert 0"))
+	assert.Equal(t, "I'll tell you when you are `3º`\nNo alert when someone jumps ahead of you", c.execute("1", "alert 3"))
+	assert.Equal(t, "I'll tell you when you are `3º`\nI'll tell you when someone jumps ahead of you", c.execute("1", "alert jump"))
+
+	saved, err := preferences.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, preference.DeliveryDm, saved.Of("1").Delivery(preference.TopicPosition), "position notifications are turned on")
+	assert.Equal(t, "No alert of a position\nNo alert when someone jumps ahead of you", c.execute("1", "alert off"))
+}
+
+func TestController_watch(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	preferences := &preference.RepositoryMock{}
+	c := newController(ioutil.Discard, nil, nil, nil, preferences, preference.NewLocalizerMock(), nil, nil, newRateLimiter(ioutil.Discard, config.RateLimits{}, clock.New()), clock.New())
+	assert.Equal(t, "I'll tell you when the queue is empty and who holds it", c.execute("1", "watch"))
+	assert.Equal(t, "Usage: `watch [empty|holder|both]`", c.execute("1", "watch all"))
+	assert.Equal(t, "I'll tell you when the queue is empty", c.execute("1", "watch empty"))
+
+	saved, err := preferences.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, preference.WatchEmpty, saved.Of("1").Watch)
+
+	assert.Equal(t, "You don't watch the queue anymore", c.execute("1", "unwatch"))
+	saved, err = preferences.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, preference.WatchScope(""), saved.Of("1").Watch)
+}
+
+func TestController_show_hold_duration_and_estimate(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	fake := clock.NewFake(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	users := usermock.NewUserRepository(map[string]model.User{
+		"1": {Id: "1", FullName: "Joe", DisplayName: "joe"},
+		"2": {Id: "2", FullName: "Ann", DisplayName: "ann"},
+	})
+	queue := model.Queue{Entities: []model.QueueEntity{{UserId: "1"}, {UserId: "2"}}, HoldTs: fake.Now()}
+	queueService := impl.NewQueueService(&queuemock.QueueRepository{Queue: queue}, &eventmock.QueueChangedEventBus{}, gateway.Mock{}, preference.NewLocalizerMock(), time.Minute*7, usecase.NotifyAbsent, fake)
+	estimates := &estimate.RepositoryMock{}
+	assert.Nil(t, estimates.Save(estimate.Estimate{Average: time.Minute * 45, Estimations: 1}))
+	c := newController(ioutil.Discard, users, queueService, estimates, &preference.RepositoryMock{}, preference.NewLocalizerMock(),
+		preference.NewFormatter(preference.NewLocalizerMock(), users), nil, newRateLimiter(ioutil.Discard, config.RateLimits{}, fake), fake)
+
+	fake.Advance(time.Minute * 35)
+	txt := c.execute("2", "show")
+	assert.Contains(t, txt, ":lock: 35 minutes")
+	assert.Contains(t, txt, "~10 minutes")
+	assert.Contains(t, txt, fmt.Sprintf("<!date^%d^", fake.Now().Add(time.Minute*10).Unix()))
+
+	fake.Advance(time.Hour)
+	txt = c.execute("2", "show")
+	assert.Contains(t, txt, ":lock: 1 hour 35 minutes")
+	assert.NotContains(t, txt, "~", "the holder is late, the next one is up any moment")
+}
@@ -2,36 +2,55 @@ package app
 
 import (
 	"fmt"
+	"github.com/yonesko/slack-queue-bot/clock"
 	"github.com/yonesko/slack-queue-bot/estimate"
+	"github.com/yonesko/slack-queue-bot/gateway"
 	"github.com/yonesko/slack-queue-bot/i18n"
 	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
 	"github.com/yonesko/slack-queue-bot/usecase"
 	"github.com/yonesko/slack-queue-bot/user"
 	"io"
 	"log"
-	"math"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Controller struct {
-	queueService       usecase.QueueService
-	estimateRepository estimate.Repository
-	logger             *log.Logger
-	userRepository     user.Repository
+	queueService         usecase.QueueService
+	estimateRepository   estimate.Repository
+	logger               *log.Logger
+	userRepository       user.Repository
+	preferenceRepository preference.Repository
+	localizer            preference.Localizer
+	formatter            preference.Formatter
+	commands             registry
+	adminUserIds         []string
+	rateLimiter          *rateLimiter
+	clock                clock.Clock
 }
 
-func newController(lumberWriter io.Writer, userRepository user.Repository, queueService usecase.QueueService, estimateRepository estimate.Repository) *Controller {
+func newController(lumberWriter io.Writer, userRepository user.Repository, queueService usecase.QueueService, estimateRepository estimate.Repository, preferenceRepository preference.Repository, localizer preference.Localizer, formatter preference.Formatter, adminUserIds []string, rateLimiter *rateLimiter, clock clock.Clock) *Controller {
 	return &Controller{
-		queueService:       queueService,
-		logger:             log.New(lumberWriter, "controller: ", log.Lshortfile|log.LstdFlags),
-		userRepository:     userRepository,
-		estimateRepository: estimateRepository,
+		queueService:         queueService,
+		logger:               log.New(lumberWriter, "controller: ", log.Lshortfile|log.LstdFlags),
+		userRepository:       userRepository,
+		estimateRepository:   estimateRepository,
+		preferenceRepository: preferenceRepository,
+		localizer:            localizer,
+		formatter:            formatter,
+		commands:             newRegistry(),
+		adminUserIds:         adminUserIds,
+		rateLimiter:          rateLimiter,
+		clock:                clock,
 	}
 }
 
-func (c *Controller) execute(command usecase.Command) string {
+//execute runs the command typed by the author, txt is the message without mentions of the bot,
+//the answer is empty if the author is throttled and has been told about it already
+func (c *Controller) execute(authorUserId string, txt string) string {
 	defer func() {
 		if r := recover(); r != nil {
 			c.logger.Printf("catch panic: %#v", r)
@@ -39,49 +58,65 @@ func (c *Controller) execute(command usecase.Command) string {
 		}
 	}()
 
-	var txt string
-	var err error
-	switch command.Data.(type) {
-	case usecase.AddCommand:
-		txt, err = c.addUser(command.AuthorUserId)
-	case usecase.DelCommand:
-		txt, err = c.deleteUser(command.AuthorUserId)
-	case usecase.ShowCommand:
-		txt, err = c.showQueue(command.AuthorUserId)
-	case usecase.CleanCommand:
-		txt, err = c.clean(command.AuthorUserId)
-	case usecase.PopCommand:
-		txt, err = c.pop(command.AuthorUserId)
-	case usecase.AckCommand:
-		txt, err = c.ack(command.AuthorUserId)
-	case usecase.PassCommand:
-		txt, err = c.pass(command.AuthorUserId)
-	default:
-		c.logger.Printf("undefined command : %v", command)
-		return c.showHelp(command.AuthorUserId)
+	labels := c.labels(authorUserId)
+	fields := strings.Fields(txt)
+	cmd, ok := command{}, false
+	if len(fields) > 0 {
+		cmd, ok = c.commands.find(fields[0])
+	}
+	switch c.rateLimiter.allow(authorUserId, !ok || cmd.readOnly) {
+	case throttled:
+		return labels.MustGet("too_many_commands")
+	case muted:
+		return ""
+	}
+	if len(fields) == 0 {
+		return c.showHelp(authorUserId)
+	}
+	if !ok {
+		c.logger.Printf("undefined command : %s", txt)
+		if suggestion, ok := c.commands.suggest(fields[0]); ok {
+			return labels.Format("did_you_mean", i18n.Params{"command": suggestion})
+		}
+		return c.showHelp(authorUserId)
+	}
+	if !cmd.acceptsArgs(len(fields) - 1) {
+		return labels.Format("wrong_usage", i18n.Params{"usage": cmd.usage(labels)})
 	}
+	if cmd.permission == admins && !c.isAdmin(authorUserId) {
+		return labels.MustGet("admins_only_command")
+	}
+	resp, err := cmd.handler(c, authorUserId, fields[1:])
 	if err != nil {
 		c.logger.Println(err)
-		return i18n.L.MustGet("error_occurred")
+		return labels.MustGet("error_occurred")
 	}
-	return txt
+	return resp
+}
+
+func (c *Controller) isAdmin(userId string) bool {
+	return len(c.adminUserIds) == 0 || contains(c.adminUserIds, userId)
+}
+
+func (c *Controller) labels(userId string) i18n.Labels {
+	return c.localizer.Labels(userId)
 }
 
 func (c *Controller) addUser(authorUserId string) (string, error) {
 	err := c.queueService.Add(model.QueueEntity{UserId: authorUserId})
 	if err == usecase.AlreadyExistErr {
-		return c.appendQueue(i18n.L.MustGet("you_are_already_in_the_queue"), authorUserId), nil
+		return c.appendQueue(c.labels(authorUserId).MustGet("you_are_already_in_the_queue"), authorUserId), nil
 	}
 	if err != nil {
 		return "", err
 	}
-	return c.appendQueue(i18n.L.MustGet("added_successfully"), authorUserId), nil
+	return c.appendQueue(c.labels(authorUserId).MustGet("added_successfully"), authorUserId), nil
 }
 
 func (c *Controller) deleteUser(authorUserId string) (string, error) {
 	err := c.queueService.DeleteById(authorUserId, authorUserId)
 	if err == usecase.NoSuchUserErr {
-		return c.appendQueue(i18n.L.MustGet("you_are_not_in_the_queue"), authorUserId), nil
+		return c.appendQueue(c.labels(authorUserId).MustGet("you_are_not_in_the_queue"), authorUserId), nil
 	}
 	if err == usecase.QueueIsEmpty {
 		return c.showQueue(authorUserId)
@@ -89,7 +124,7 @@ func (c *Controller) deleteUser(authorUserId string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return c.appendQueue(i18n.L.MustGet("deleted_successfully"), authorUserId), nil
+	return c.appendQueue(c.labels(authorUserId).MustGet("deleted_successfully"), authorUserId), nil
 }
 
 func (c *Controller) appendQueue(txt string, authorUserId string) string {
@@ -114,7 +149,7 @@ func (c *Controller) showQueue(authorUserId string) (string, error) {
 
 func (c *Controller) composeShowQueueText(queue model.Queue, authorUserId string) (string, error) {
 	if len(queue.Entities) == 0 {
-		return i18n.L.MustGet("queue_is_empty"), nil
+		return c.labels(authorUserId).MustGet("queue_is_empty"), nil
 	}
 	txt := ""
 	for i, u := range queue.Entities {
@@ -122,15 +157,15 @@ func (c *Controller) composeShowQueueText(queue model.Queue, authorUserId string
 		if err != nil {
 			return "", fmt.Errorf("can't composeShowQueueText: %s", err)
 		}
-		txt += fmt.Sprintf(
-			"`%dº` %s (%s) %s%s%s\n",
-			i+1,
-			user.FullName,
-			user.DisplayName,
-			c.highlightTxt(u, authorUserId, i, queue),
-			holdDurationTxt(i, queue),
-			isSleepingTxt(i, queue),
-		)
+		txt += c.labels(authorUserId).Format("queue_entry", i18n.Params{
+			"position":     i + 1,
+			"full_name":    user.FullName,
+			"display_name": user.DisplayName,
+			"highlight":    c.highlightTxt(u, authorUserId, i, queue),
+			"hold":         c.holdDurationTxt(i, queue, authorUserId),
+			"sleeping":     isSleepingTxt(i, queue),
+			"deferral":     deferralTxt(c.labels(authorUserId), u.UserId, queue),
+		}) + "\n"
 	}
 	return txt, nil
 }
@@ -139,50 +174,20 @@ func (c *Controller) highlightTxt(u model.QueueEntity, authorUserId string, i in
 	if u.UserId == authorUserId {
 		txt := ":point_left::skin-tone-2:"
 		if i > 0 {
-			txt += c.estimateTxt(i, queue)
+			txt += c.estimateTxt(i, queue, authorUserId)
 		}
 		return txt
 	}
 	return ""
 }
 
-func holdDurationTxt(i int, queue model.Queue) string {
+func (c *Controller) holdDurationTxt(i int, queue model.Queue, authorUserId string) string {
 	if i == 0 && queue.HoldTs.Unix() > 0 {
-		return " :lock: " + humanizeDuration(time.Now().Sub(queue.HoldTs))
+		return " :lock: " + c.formatter.Duration(authorUserId, c.clock.Now().Sub(queue.HoldTs))
 	}
 	return ""
 }
 
-func humanizeDuration(duration time.Duration) string {
-	days := int64(duration.Hours() / 24)
-	hours := int64(math.Mod(duration.Hours(), 24))
-	minutes := int64(math.Mod(duration.Minutes(), 60))
-	seconds := int64(math.Mod(duration.Seconds(), 60))
-
-	chunks := []struct {
-		singularName string
-		amount       int64
-	}{
-		{"d", days},
-		{"h", hours},
-		{"m", minutes},
-		{"s", seconds},
-	}
-
-	parts := []string{}
-
-	for _, chunk := range chunks {
-		switch chunk.amount {
-		case 0:
-			continue
-		default:
-			parts = append(parts, fmt.Sprintf("%d%s", chunk.amount, chunk.singularName))
-		}
-	}
-
-	return strings.Join(parts, "")
-}
-
 func isSleepingTxt(i int, queue model.Queue) string {
 	if queue.HolderIsSleeping && i == 0 {
 		return " :sleeping:"
@@ -190,21 +195,53 @@ func isSleepingTxt(i int, queue model.Queue) string {
 	return ""
 }
 
-func (c *Controller) estimateTxt(i int, queue model.Queue) string {
+//deferralTxt tells that the user's turn is skipped or waits because they are away or in DND
+func deferralTxt(labels i18n.Labels, userId string, queue model.Queue) string {
+	deferral, ok := queue.Deferrals[userId]
+	if !ok {
+		return ""
+	}
+	absence := ""
+	switch deferral.Absence {
+	case gateway.AbsenceAway:
+		absence = labels.MustGet("absence_away")
+	case gateway.AbsenceDnd:
+		absence = labels.MustGet("absence_dnd")
+	}
+	if deferral.Skipped {
+		return " " + labels.Format("deferral_skipped", i18n.Params{"absence": absence})
+	}
+	return " " + labels.Format("deferral_waiting", i18n.Params{"absence": absence})
+}
+
+func (c *Controller) estimateTxt(i int, queue model.Queue, authorUserId string) string {
 	estimate, err := c.estimateRepository.Read()
 	if err != nil {
 		c.logger.Printf("composeShowQueueText can't get estimate %s", err)
 		return ""
 	}
-	duration := estimate.TimeToWait(uint(i), queue.HoldTs).Round(time.Second)
+	duration := estimate.TimeToWait(uint(i), queue.HoldTs, c.clock.Now()).Round(time.Second)
 	if duration == 0 {
 		return ""
 	}
-	return fmt.Sprintf("~%s (%s)", humanizeDuration(duration), time.Now().Add(duration).Format("Mon Jan 2 15:04"))
+	return fmt.Sprintf("~%s (%s)", c.formatter.Duration(authorUserId, duration), c.formatter.Time(authorUserId, c.clock.Now().Add(duration)))
 }
 
 func (c *Controller) showHelp(authorUserId string) string {
-	return fmt.Sprintf(i18n.L.MustGet("help_text"), c.title(authorUserId))
+	labels := c.labels(authorUserId)
+	lines := []string{labels.Format("help_text", i18n.Params{"name": c.title(authorUserId)})}
+	for _, cmd := range c.commands {
+		lines = append(lines, cmd.help(labels))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *Controller) showCommandHelp(authorUserId string, name string) string {
+	cmd, ok := c.commands.find(name)
+	if !ok {
+		return c.showHelp(authorUserId)
+	}
+	return cmd.help(c.labels(authorUserId))
 }
 
 func (c *Controller) clean(authorUserId string) (string, error) {
@@ -215,20 +252,20 @@ func (c *Controller) clean(authorUserId string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return c.appendQueue(i18n.L.MustGet("cleaned_successfully"), authorUserId), nil
+	return c.appendQueue(c.labels(authorUserId).MustGet("cleaned_successfully"), authorUserId), nil
 }
 func (c *Controller) ack(authorUserId string) (string, error) {
 	err := c.queueService.Ack(authorUserId)
 	if err == usecase.YouAreNotHolder {
-		return "Ты не первый в очереди, твой ack не нужен", nil
+		return c.labels(authorUserId).MustGet("ack_is_not_needed"), nil
 	}
 	if err == usecase.HolderIsNotSleeping {
-		return "Ack уже получен", nil
+		return c.labels(authorUserId).MustGet("ack_is_already_received"), nil
 	}
 	if err != nil {
 		return "", err
 	}
-	return c.appendQueue(i18n.L.MustGet("ack_is_ok"), authorUserId), nil
+	return c.appendQueue(c.labels(authorUserId).MustGet("ack_is_ok"), authorUserId), nil
 }
 func (c *Controller) pop(authorUserId string) (string, error) {
 	deletedUserId, err := c.queueService.Pop(authorUserId)
@@ -238,7 +275,7 @@ func (c *Controller) pop(authorUserId string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	txt := fmt.Sprintf(i18n.L.MustGet("popped_successfully"), c.deletedUserTxt(deletedUserId))
+	txt := c.labels(authorUserId).Format("popped_successfully", i18n.Params{"user": c.deletedUserTxt(deletedUserId)})
 	return c.appendQueue(txt, authorUserId), nil
 }
 func (c *Controller) pass(authorUserId string) (string, error) {
@@ -247,12 +284,184 @@ func (c *Controller) pass(authorUserId string) (string, error) {
 		return c.showQueue(authorUserId)
 	}
 	if err == usecase.NoSuchUserErr {
-		return c.appendQueue(i18n.L.MustGet("you_are_not_in_the_queue"), authorUserId), nil
+		return c.appendQueue(c.labels(authorUserId).MustGet("you_are_not_in_the_queue"), authorUserId), nil
 	}
 	if err == usecase.NoOneToPass {
-		return "Некому передать", nil
+		return c.labels(authorUserId).MustGet("no_one_to_pass"), nil
+	}
+	return c.appendQueue(c.labels(authorUserId).MustGet("passed_successfully"), authorUserId), nil
+}
+
+func (c *Controller) lang(authorUserId string, code string) (string, error) {
+	language, ok := i18n.LanguageByCode(code)
+	if !ok {
+		return c.labels(authorUserId).Format("unknown_language", i18n.Params{"codes": strings.Join(i18n.Codes(), "|")}), nil
+	}
+	preferences, err := c.preferenceRepository.Read()
+	if err != nil {
+		return "", err
+	}
+	userPreferences := preferences.Of(authorUserId)
+	userPreferences.Language = language
+	err = c.preferenceRepository.Save(preferences.With(authorUserId, userPreferences))
+	if err != nil {
+		return "", err
+	}
+	return c.labels(authorUserId).MustGet("language_changed"), nil
+}
+
+//notify shows notification settings of the author or, given a topic and a delivery, changes it
+func (c *Controller) notify(authorUserId string, args []string) (string, error) {
+	labels := c.labels(authorUserId)
+	preferences, err := c.preferenceRepository.Read()
+	if err != nil {
+		return "", err
 	}
-	return c.appendQueue("Махнул тебя", authorUserId), nil
+	userPreferences := preferences.Of(authorUserId)
+	if len(args) == 0 {
+		return c.notificationsTxt(labels, userPreferences), nil
+	}
+	topic := preference.Topic(strings.ToLower(args[0]))
+	if !topic.IsValid() {
+		var topics []string
+		for _, t := range preference.Topics {
+			topics = append(topics, string(t))
+		}
+		return labels.Format("unknown_topic", i18n.Params{"topics": strings.Join(topics, "|")}), nil
+	}
+	if len(args) == 1 {
+		return topicTxt(labels, topic, userPreferences.Delivery(topic)), nil
+	}
+	delivery := preference.Delivery(strings.ToLower(args[1]))
+	if !delivery.IsValid() {
+		return labels.Format("unknown_delivery", i18n.Params{"deliveries": deliveriesUsage()}), nil
+	}
+	if !delivery.IsValidFor(topic) {
+		return labels.MustGet("holder_cant_be_off"), nil
+	}
+	userPreferences = userPreferences.WithDelivery(topic, delivery)
+	if err := c.preferenceRepository.Save(preferences.With(authorUserId, userPreferences)); err != nil {
+		return "", err
+	}
+	return labels.MustGet("notifications_changed") + "\n" + c.notificationsTxt(labels, userPreferences), nil
+}
+
+//alert shows position alerts of the author or turns one on, turning position notifications on if they are off
+func (c *Controller) alert(authorUserId string, args []string) (string, error) {
+	labels := c.labels(authorUserId)
+	preferences, err := c.preferenceRepository.Read()
+	if err != nil {
+		return "", err
+	}
+	userPreferences := preferences.Of(authorUserId)
+	if len(args) == 0 {
+		return alertsTxt(labels, userPreferences), nil
+	}
+	switch arg := strings.ToLower(args[0]); arg {
+	case "off":
+		userPreferences.AlertPosition, userPreferences.AlertJumps = 0, false
+	case "jump":
+		userPreferences.AlertJumps = true
+	default:
+		position, err := strconv.Atoi(arg)
+		if err != nil || position < 1 {
+			return labels.Format("wrong_usage", i18n.Params{"usage": "alert <N|jump|off>"}), nil
+		}
+		userPreferences.AlertPosition = position
+	}
+	if userPreferences.Delivery(preference.TopicPosition) == preference.DeliveryOff && (userPreferences.AlertPosition > 0 || userPreferences.AlertJumps) {
+		userPreferences = userPreferences.WithDelivery(preference.TopicPosition, preference.DeliveryDm)
+	}
+	if err := c.preferenceRepository.Save(preferences.With(authorUserId, userPreferences)); err != nil {
+		return "", err
+	}
+	return alertsTxt(labels, userPreferences), nil
+}
+
+func alertsTxt(labels i18n.Labels, userPreferences preference.UserPreferences) string {
+	lines := []string{labels.MustGet("alert_position_off")}
+	if userPreferences.AlertPosition > 0 {
+		lines[0] = labels.Format("alert_position_on", i18n.Params{"position": userPreferences.AlertPosition})
+	}
+	if userPreferences.AlertJumps {
+		lines = append(lines, labels.MustGet("alert_jumps_on"))
+	} else {
+		lines = append(lines, labels.MustGet("alert_jumps_off"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+//watch subscribes the author to the queue without joining it, to both empty queue and new holders by default
+func (c *Controller) watch(authorUserId string, args []string) (string, error) {
+	labels := c.labels(authorUserId)
+	scope := preference.WatchBoth
+	if len(args) > 0 {
+		scope = preference.WatchScope(strings.ToLower(args[0]))
+	}
+	if !scope.IsValid() {
+		return labels.Format("wrong_usage", i18n.Params{"usage": "watch [empty|holder|both]"}), nil
+	}
+	if err := c.saveWatch(authorUserId, scope); err != nil {
+		return "", err
+	}
+	switch scope {
+	case preference.WatchEmpty:
+		return labels.MustGet("watching_empty"), nil
+	case preference.WatchHolder:
+		return labels.MustGet("watching_holder"), nil
+	}
+	return labels.MustGet("watching_both"), nil
+}
+
+func (c *Controller) unwatch(authorUserId string) (string, error) {
+	if err := c.saveWatch(authorUserId, ""); err != nil {
+		return "", err
+	}
+	return c.labels(authorUserId).MustGet("not_watching"), nil
+}
+
+func (c *Controller) saveWatch(userId string, scope preference.WatchScope) error {
+	preferences, err := c.preferenceRepository.Read()
+	if err != nil {
+		return err
+	}
+	userPreferences := preferences.Of(userId)
+	userPreferences.Watch = scope
+	return c.preferenceRepository.Save(preferences.With(userId, userPreferences))
+}
+
+func (c *Controller) notificationsTxt(labels i18n.Labels, userPreferences preference.UserPreferences) string {
+	lines := []string{labels.MustGet("notifications_title")}
+	for _, topic := range preference.Topics {
+		lines = append(lines, topicTxt(labels, topic, userPreferences.Delivery(topic)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func topicTxt(labels i18n.Labels, topic preference.Topic, delivery preference.Delivery) string {
+	description := ""
+	switch topic {
+	case preference.TopicSecond:
+		description = labels.MustGet("topic_second")
+	case preference.TopicPosition:
+		description = labels.MustGet("topic_position")
+	case preference.TopicDeleted:
+		description = labels.MustGet("topic_deleted")
+	case preference.TopicEmpty:
+		description = labels.MustGet("topic_empty")
+	case preference.TopicHolder:
+		description = labels.MustGet("topic_holder")
+	}
+	deliveryTxt := ""
+	switch delivery {
+	case preference.DeliveryDm:
+		deliveryTxt = labels.MustGet("delivery_dm")
+	case preference.DeliveryChannel:
+		deliveryTxt = labels.MustGet("delivery_channel")
+	case preference.DeliveryOff:
+		deliveryTxt = labels.MustGet("delivery_off")
+	}
+	return labels.Format("notification_setting", i18n.Params{"topic": topic, "description": description, "delivery": deliveryTxt})
 }
 
 func (c *Controller) deletedUserTxt(deletedUserId string) string {
@@ -266,5 +475,5 @@ func (c *Controller) title(userId string) string {
 	if user, err := c.userRepository.FindById(userId); err == nil {
 		return strings.TrimSpace(user.FullName)
 	}
-	return "human"
+	return c.labels(userId).MustGet("someone")
 }
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/config"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+type verdict int
+
+const (
+	allowed verdict = iota
+	//throttled is the first rejection since the bucket was refilled, the user is told to slow down
+	throttled
+	//muted rejections are not answered, so spamming the bot doesn't spend Slack API quota
+	muted
+)
+
+type bucketKey struct {
+	userId   string
+	readOnly bool
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	//told is set when the user is answered they are throttled, it is reset when the bucket refills
+	told bool
+}
+
+//rateLimiter keeps a token bucket per user and kind of command
+type rateLimiter struct {
+	mu      sync.Mutex
+	limits  config.RateLimits
+	buckets map[bucketKey]*tokenBucket
+	//rejected counts rejected commands of each user
+	rejected map[string]int
+	clock    clock.Clock
+	logger   *log.Logger
+}
+
+func newRateLimiter(lumberWriter io.Writer, limits config.RateLimits, clock clock.Clock) *rateLimiter {
+	return &rateLimiter{
+		limits:   limits,
+		buckets:  map[bucketKey]*tokenBucket{},
+		rejected: map[string]int{},
+		clock:    clock,
+		logger:   log.New(lumberWriter, "rate-limiter: ", log.Lshortfile|log.LstdFlags),
+	}
+}
+
+func (r *rateLimiter) allow(userId string, readOnly bool) verdict {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limit := r.limits.Mutating
+	if readOnly {
+		limit = r.limits.ReadOnly
+	}
+	if limit.Burst == 0 {
+		return allowed
+	}
+	bucket := r.refill(bucketKey{userId, readOnly}, limit)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return allowed
+	}
+	r.rejected[userId]++
+	r.logger.Printf("%s is throttled, %d commands rejected so far", userId, r.rejected[userId])
+	if bucket.told {
+		return muted
+	}
+	bucket.told = true
+	return throttled
+}
+
+//Rejected counts rejected commands of every user since the start
+func (r *rateLimiter) Rejected() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rejected := map[string]int{}
+	for userId, n := range r.rejected {
+		rejected[userId] = n
+	}
+	return rejected
+}
+
+func (r *rateLimiter) refill(key bucketKey, limit config.RateLimit) *tokenBucket {
+	now := r.clock.Now()
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		r.buckets[key] = bucket
+	}
+	bucket.tokens += float64(now.Sub(bucket.last)) / float64(limit.Every)
+	if bucket.tokens > float64(limit.Burst) {
+		bucket.tokens = float64(limit.Burst)
+	}
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.told = false
+	}
+	return bucket
+}
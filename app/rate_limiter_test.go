@@ -0,0 +1,44 @@
+package app
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/config"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_allow(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	r := newRateLimiter(ioutil.Discard, config.RateLimits{
+		ReadOnly: config.RateLimit{Burst: 2, Every: time.Second * 10},
+		Mutating: config.RateLimit{Burst: 1, Every: time.Minute},
+	}, fake)
+
+	assert.Equal(t, allowed, r.allow("1", true))
+	assert.Equal(t, allowed, r.allow("1", true))
+	assert.Equal(t, throttled, r.allow("1", true))
+	assert.Equal(t, muted, r.allow("1", true))
+	assert.Equal(t, allowed, r.allow("1", false), "read-only commands don't spend the mutating budget")
+	assert.Equal(t, throttled, r.allow("1", false), "user is told again after being allowed")
+	assert.Equal(t, allowed, r.allow("2", true), "budgets are per user")
+	assert.Equal(t, map[string]int{"1": 3}, r.Rejected())
+
+	fake.Advance(time.Second * 10)
+	assert.Equal(t, allowed, r.allow("1", true), "a token is refilled")
+	assert.Equal(t, throttled, r.allow("1", true), "user is told again after the bucket refills")
+	assert.Equal(t, muted, r.allow("1", true))
+	fake.Advance(time.Second * 5)
+	assert.Equal(t, muted, r.allow("1", true), "half a token doesn't refill the bucket")
+	fake.Advance(time.Second * 5)
+	assert.Equal(t, allowed, r.allow("1", true))
+	assert.Equal(t, muted, r.allow("1", false), "the mutating bucket has its own refill")
+}
+
+func TestRateLimiter_off(t *testing.T) {
+	r := newRateLimiter(ioutil.Discard, config.RateLimits{}, clock.New())
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, allowed, r.allow("1", false))
+	}
+}
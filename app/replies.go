@@ -0,0 +1,168 @@
+package app
+
+import (
+	"github.com/nlopes/slack"
+	"io"
+	"log"
+)
+
+//maxAnswered is how many answered messages are remembered to not answer them twice
+const maxAnswered = 1000
+
+//rtmSender is the part of RTM to answer commands
+type rtmSender interface {
+	NewOutgoingMessage(text string, channelID string, options ...slack.RTMsgOption) *slack.OutgoingMessage
+	SendMessage(msg *slack.OutgoingMessage)
+}
+
+//postApi is the part of Slack API replies fall back to, history tells if a reply has been delivered after all
+type postApi interface {
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	GetConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	GetConversationReplies(params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error)
+}
+
+type reply struct {
+	//key is the channel and ts of the message answered
+	key string
+	//ts of the message answered, the reply is posted after it
+	ts       string
+	channel  string
+	threadTs string
+	text     string
+	resent   bool
+}
+
+//replies tracks answers sent via RTM until Slack acks them, a failed answer is sent via RTM once more,
+//then via chat.postMessage; it is used from the RTM event loop only
+type replies struct {
+	rtm       rtmSender
+	api       postApi
+	botUserId string
+	pending   map[int]reply
+	//answered are keys of answered messages in order of answering, Slack may redeliver messages after reconnects
+	answered    map[string]bool
+	answeredLog []string
+	logger      *log.Logger
+}
+
+func newReplies(lumberWriter io.Writer, rtm rtmSender, api postApi, botUserId string) *replies {
+	return &replies{
+		rtm:       rtm,
+		api:       api,
+		botUserId: botUserId,
+		pending:   map[int]reply{},
+		answered:  map[string]bool{},
+		logger:    log.New(lumberWriter, "replies: ", log.Lshortfile|log.LstdFlags),
+	}
+}
+
+//isAnswered tells if the message has been answered already
+func (r *replies) isAnswered(channel, ts string) bool {
+	return r.answered[channel+"/"+ts]
+}
+
+//send answers the message with ts in channel
+func (r *replies) send(channel, ts, threadTs, text string) {
+	key := channel + "/" + ts
+	r.remember(key)
+	r.sendRtm(reply{key: key, ts: ts, channel: channel, threadTs: threadTs, text: text})
+}
+
+func (r *replies) remember(key string) {
+	r.answered[key] = true
+	r.answeredLog = append(r.answeredLog, key)
+	if len(r.answeredLog) > maxAnswered {
+		delete(r.answered, r.answeredLog[0])
+		r.answeredLog = r.answeredLog[1:]
+	}
+}
+
+func (r *replies) sendRtm(reply reply) {
+	msg := r.rtm.NewOutgoingMessage(reply.text, reply.channel, slack.RTMsgOptionTS(reply.threadTs))
+	r.pending[msg.ID] = reply
+	r.logger.Printf("reply %d to %s: '%s'", msg.ID, reply.key, reply.text)
+	r.rtm.SendMessage(msg)
+}
+
+func (r *replies) acked(replyTo int) {
+	if reply, ok := r.pending[replyTo]; ok {
+		r.logger.Printf("reply %d to %s is delivered", replyTo, reply.key)
+		delete(r.pending, replyTo)
+	}
+}
+
+func (r *replies) failed(ev *slack.OutgoingErrorEvent) {
+	reply, ok := r.pending[ev.Message.ID]
+	if !ok {
+		r.logger.Printf("unknown reply %d failed: %s", ev.Message.ID, ev.ErrorObj)
+		return
+	}
+	delete(r.pending, ev.Message.ID)
+	r.logger.Printf("reply %d to %s failed: %s", ev.Message.ID, reply.key, ev.ErrorObj)
+	if !reply.resent {
+		reply.resent = true
+		r.sendRtm(reply)
+		return
+	}
+	r.post(reply)
+}
+
+//reconnected posts replies not acked before the connection was lost, RTM doesn't ack them anymore,
+//a reply may be delivered with the ack lost, so it is looked up in the channel first
+func (r *replies) reconnected() {
+	for id, reply := range r.pending {
+		delete(r.pending, id)
+		r.logger.Printf("reply %d to %s isn't acked before reconnect", id, reply.key)
+		delivered, err := r.isDelivered(reply)
+		if err != nil {
+			r.logger.Printf("can't look up reply to %s, post it: %s", reply.key, err)
+		}
+		if delivered {
+			r.logger.Printf("reply to %s is delivered", reply.key)
+			continue
+		}
+		r.post(reply)
+	}
+}
+
+//isDelivered looks for the reply among messages of the bot after the answered one
+func (r *replies) isDelivered(reply reply) (bool, error) {
+	var messages []slack.Message
+	if reply.threadTs != "" {
+		replies, _, _, err := r.api.GetConversationReplies(&slack.GetConversationRepliesParameters{
+			ChannelID: reply.channel, Timestamp: reply.threadTs, Oldest: reply.ts,
+		})
+		if err != nil {
+			return false, err
+		}
+		messages = replies
+	} else {
+		history, err := r.api.GetConversationHistory(&slack.GetConversationHistoryParameters{
+			ChannelID: reply.channel, Oldest: reply.ts,
+		})
+		if err != nil {
+			return false, err
+		}
+		messages = history.Messages
+	}
+	for _, m := range messages {
+		if m.User == r.botUserId && m.Text == reply.text {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *replies) post(reply reply) {
+	options := []slack.MsgOption{slack.MsgOptionText(reply.text, false), slack.MsgOptionAsUser(true)}
+	if reply.threadTs != "" {
+		options = append(options, slack.MsgOptionTS(reply.threadTs))
+	}
+	_, ts, err := r.api.PostMessage(reply.channel, options...)
+	if err != nil {
+		r.logger.Printf("can't post reply to %s, give up: %s", reply.key, err)
+		return
+	}
+	r.logger.Printf("reply to %s is posted as %s", reply.key, ts)
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"errors"
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+type rtmMock struct {
+	id   int
+	sent []string
+}
+
+func (r *rtmMock) NewOutgoingMessage(text string, channelID string, options ...slack.RTMsgOption) *slack.OutgoingMessage {
+	r.id++
+	return &slack.OutgoingMessage{ID: r.id, Channel: channelID, Text: text}
+}
+
+func (r *rtmMock) SendMessage(msg *slack.OutgoingMessage) {
+	r.sent = append(r.sent, msg.Channel+": "+msg.Text)
+}
+
+type postApiMock struct {
+	posted []string
+	//history are messages in channels and threads by their ids
+	history map[string][]slack.Message
+}
+
+func (p *postApiMock) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
+	p.posted = append(p.posted, channelID)
+	return channelID, "1.1", nil
+}
+
+func (p *postApiMock) GetConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	return &slack.GetConversationHistoryResponse{Messages: p.history[params.ChannelID]}, nil
+}
+
+func (p *postApiMock) GetConversationReplies(params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error) {
+	return p.history[params.ChannelID+"/"+params.Timestamp], false, "", nil
+}
+
+func TestReplies_failed_reply_is_resent_then_posted(t *testing.T) {
+	rtm, api := &rtmMock{}, &postApiMock{}
+	r := newReplies(ioutil.Discard, rtm, api, "B1")
+
+	r.send("D1", "100.1", "", "added")
+	assert.True(t, r.isAnswered("D1", "100.1"))
+	assert.False(t, r.isAnswered("D1", "100.2"))
+
+	r.failed(&slack.OutgoingErrorEvent{Message: slack.OutgoingMessage{ID: 1}, ErrorObj: errors.New("timeout")})
+	assert.Equal(t, []string{"D1: added", "D1: added"}, rtm.sent)
+	assert.Empty(t, api.posted)
+
+	r.failed(&slack.OutgoingErrorEvent{Message: slack.OutgoingMessage{ID: 2}, ErrorObj: errors.New("timeout")})
+	assert.Equal(t, []string{"D1"}, api.posted)
+	assert.Empty(t, r.pending)
+}
+
+func TestReplies_acked_reply_is_not_resent_after_reconnect(t *testing.T) {
+	rtm, api := &rtmMock{}, &postApiMock{}
+	r := newReplies(ioutil.Discard, rtm, api, "B1")
+
+	r.send("D1", "100.1", "", "added")
+	r.send("D2", "100.2", "", "deleted")
+	r.acked(1)
+	r.reconnected()
+	assert.Equal(t, []string{"D2"}, api.posted)
+	assert.Empty(t, r.pending)
+}
+
+func TestReplies_delivered_reply_is_not_reposted_after_reconnect(t *testing.T) {
+	rtm := &rtmMock{}
+	api := &postApiMock{history: map[string][]slack.Message{
+		"D1":       {botMessage("U1", "added"), botMessage("B1", "added")},
+		"C1/100.0": {botMessage("B1", "deleted")},
+		"D3":       {botMessage("B1", "other")},
+	}}
+	r := newReplies(ioutil.Discard, rtm, api, "B1")
+
+	r.send("D1", "100.1", "", "added")
+	r.send("C1", "100.2", "100.0", "deleted")
+	r.send("D3", "100.3", "", "popped")
+	r.reconnected()
+	assert.Equal(t, []string{"D3"}, api.posted)
+	assert.Empty(t, r.pending)
+}
+
+func botMessage(userId, text string) slack.Message {
+	return slack.Message{Msg: slack.Msg{User: userId, Text: text}}
+}
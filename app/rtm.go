@@ -3,8 +3,8 @@ package app
 import (
 	"fmt"
 	"github.com/nlopes/slack"
-	"github.com/yonesko/slack-queue-bot/usecase"
 	"log"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -28,39 +28,29 @@ func connectToRTM(slackApi *slack.Client) *slack.RTM {
 	}
 }
 
-func needProcess(m *slack.MessageEvent) bool {
-	mention := strings.HasPrefix(m.Text, thisBotUserId)
-	isDirect := strings.HasPrefix(m.Channel, "D")
-	simple := m.SubType == "" && !m.Hidden && m.BotID == "" && m.Edited == nil && m.User != ""
-	return simple && (isDirect || mention)
+//resolveBotUserId asks Slack who this bot is, so the same binary serves any bot
+func resolveBotUserId(slackApi *slack.Client) string {
+	resp, err := slackApi.AuthTest()
+	if err != nil {
+		log.Fatal(fmt.Errorf("can't auth.test: %s", err))
+	}
+	return resp.UserID
 }
 
-func extractCommandTxt(text string) string {
-	txt := strings.Replace(text, thisBotUserId, "", 1)
-	txt = strings.ToLower(txt)
-	return strings.TrimSpace(txt)
+//mentionRe matches mentions of the user like <@USMRFHHPE> or <@USMRFHHPE|queue-bot>
+func mentionRe(userId string) *regexp.Regexp {
+	return regexp.MustCompile(`<@` + regexp.QuoteMeta(userId) + `(\|[^>]*)?>`)
 }
 
-func extractCommand(ev *slack.MessageEvent) usecase.Command {
-	return usecase.Command{AuthorUserId: ev.User, Data: extractData(ev)}
+func needProcess(m *slack.MessageEvent, botMention *regexp.Regexp) bool {
+	mention := botMention.MatchString(m.Text)
+	isDirect := strings.HasPrefix(m.Channel, "D")
+	simple := m.SubType == "" && !m.Hidden && m.BotID == "" && m.Edited == nil && m.User != ""
+	return simple && (isDirect || mention)
 }
 
-func extractData(ev *slack.MessageEvent) interface{} {
-	switch extractCommandTxt(ev.Text) {
-	case "add", "эд":
-		return usecase.AddCommand{ToAddUserId: ev.User}
-	case "del", "дел":
-		return usecase.DelCommand{ToDelUserId: ev.User}
-	case "show", "покаж":
-		return usecase.ShowCommand{}
-	case "clean":
-		return usecase.CleanCommand{}
-	case "pop":
-		return usecase.PopCommand{}
-	case "ack", "ак":
-		return usecase.AckCommand{}
-	case "pass", "пас":
-		return usecase.PassCommand{}
-	}
-	return usecase.HelpCommand{}
+func extractCommandTxt(text string, botMention *regexp.Regexp) string {
+	txt := botMention.ReplaceAllString(text, " ")
+	txt = strings.ToLower(txt)
+	return strings.Join(strings.Fields(txt), " ")
 }
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"fmt"
+	"github.com/nlopes/slack"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/estimate"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"github.com/yonesko/slack-queue-bot/status"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"github.com/yonesko/slack-queue-bot/user"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+const statusMessageRefreshInterval = time.Minute
+
+//error codes of Slack API responses
+const (
+	slackMessageNotFound = "message_not_found"
+	slackAlreadyPinned   = "already_pinned"
+)
+
+//statusApi is the part of Slack API to manage the status message
+type statusApi interface {
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+	AddPin(channel string, item slack.ItemRef) error
+}
+
+//StatusMessage keeps one pinned message in the channel showing the queue,
+//it is updated in place on every queue change and recreated if someone deletes it
+type StatusMessage struct {
+	channel            string
+	api                statusApi
+	repository         status.Repository
+	queueService       usecase.QueueService
+	userRepository     user.Repository
+	estimateRepository estimate.Repository
+	formatter          preference.Formatter
+	changes            <-chan struct{}
+	logger             *log.Logger
+	clock              clock.Clock
+}
+
+func NewStatusMessage(lumberWriter io.Writer, channel string, api statusApi, repository status.Repository, queueService usecase.QueueService, userRepository user.Repository, estimateRepository estimate.Repository, formatter preference.Formatter, changes <-chan struct{}, clock clock.Clock) *StatusMessage {
+	return &StatusMessage{
+		channel:            channel,
+		api:                api,
+		repository:         repository,
+		queueService:       queueService,
+		userRepository:     userRepository,
+		estimateRepository: estimateRepository,
+		formatter:          formatter,
+		changes:            changes,
+		logger:             log.New(lumberWriter, "status-message: ", log.Lshortfile|log.LstdFlags),
+		clock:              clock,
+	}
+}
+
+//Run refreshes the message on every notification of changes and periodically,
+//so hold time and ETAs stay actual between changes
+func (s *StatusMessage) Run() {
+	s.refresh()
+	ticker := s.clock.NewTicker(statusMessageRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case _, ok := <-s.changes:
+			if !ok {
+				return
+			}
+		case <-ticker.C():
+		}
+		s.refresh()
+	}
+}
+
+func (s *StatusMessage) refresh() {
+	if err := s.update(); err != nil {
+		s.logger.Printf("can't refresh status message: %s", err)
+	}
+}
+
+func (s *StatusMessage) update() error {
+	queue, err := s.queueService.Show()
+	if err != nil {
+		return err
+	}
+	txt := s.render(queue)
+	message, err := s.repository.Read()
+	if err != nil {
+		return err
+	}
+	if message.Ts == "" || message.Channel == "" {
+		return s.post(txt)
+	}
+	postedFor := message.StatusChannel
+	if postedFor == "" {
+		postedFor = message.Channel
+	}
+	if postedFor != s.channel {
+		s.logger.Printf("status_channel is changed from %s to %s, post the message there", postedFor, s.channel)
+		return s.post(txt)
+	}
+	_, _, _, err = s.api.UpdateMessage(message.Channel, message.Ts, slack.MsgOptionText(txt, false))
+	if isSlackError(err, slackMessageNotFound) {
+		s.logger.Printf("status message %s is deleted, recreate it", message.Ts)
+		return s.post(txt)
+	}
+	if err != nil {
+		return err
+	}
+	if !message.Pinned {
+		return s.pin(message)
+	}
+	return nil
+}
+
+func (s *StatusMessage) post(txt string) error {
+	channel, ts, err := s.api.PostMessage(s.channel, slack.MsgOptionText(txt, false), slack.MsgOptionAsUser(true))
+	if err != nil {
+		return err
+	}
+	message := status.Message{Channel: channel, Ts: ts, StatusChannel: s.channel}
+	if err := s.repository.Save(message); err != nil {
+		return err
+	}
+	return s.pin(message)
+}
+
+//pin pins the message and remembers it, so a failed pin is retried on the next update
+func (s *StatusMessage) pin(message status.Message) error {
+	err := s.api.AddPin(message.Channel, slack.NewRefToMessage(message.Channel, message.Ts))
+	if err != nil && !isSlackError(err, slackAlreadyPinned) {
+		return fmt.Errorf("can't pin %s: %s", message.Ts, err)
+	}
+	message.Pinned = true
+	return s.repository.Save(message)
+}
+
+//isSlackError tells if err is the error Slack API client returns for the response error code
+func isSlackError(err error, code string) bool {
+	return err != nil && err.Error() == slack.SlackResponse{Error: code}.Err().Error()
+}
+
+//render shows the queue to the whole channel, so it is in the bot language
+func (s *StatusMessage) render(queue model.Queue) string {
+	lines := []string{i18n.L.MustGet("status_title")}
+	if len(queue.Entities) == 0 {
+		return strings.Join(append(lines, i18n.L.MustGet("queue_is_empty")), "\n")
+	}
+	for i, entity := range queue.Entities {
+		u, err := s.userRepository.FindById(entity.UserId)
+		if err != nil {
+			s.logger.Printf("can't find user %s: %s", entity.UserId, err)
+		}
+		lines = append(lines, i18n.L.Format("queue_entry", i18n.Params{
+			"position":     i + 1,
+			"full_name":    u.FullName,
+			"display_name": u.DisplayName,
+			"highlight":    s.etaTxt(i, queue),
+			"hold":         s.holdDurationTxt(i, queue),
+			"sleeping":     isSleepingTxt(i, queue),
+			"deferral":     deferralTxt(i18n.L, entity.UserId, queue),
+		}))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *StatusMessage) holdDurationTxt(i int, queue model.Queue) string {
+	if i == 0 && queue.HoldTs.Unix() > 0 {
+		return ":lock: " + s.formatter.Duration("", s.clock.Now().Sub(queue.HoldTs).Truncate(time.Minute))
+	}
+	return ""
+}
+
+func (s *StatusMessage) etaTxt(i int, queue model.Queue) string {
+	if i == 0 {
+		return ""
+	}
+	estimate, err := s.estimateRepository.Read()
+	if err != nil {
+		s.logger.Printf("can't get estimate %s", err)
+		return ""
+	}
+	duration := estimate.TimeToWait(uint(i), queue.HoldTs, s.clock.Now()).Round(time.Minute)
+	if duration == 0 {
+		return ""
+	}
+	return fmt.Sprintf("~%s (%s)", s.formatter.Duration("", duration), s.formatter.Time("", s.clock.Now().Add(duration)))
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"errors"
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/estimate"
+	eventmock "github.com/yonesko/slack-queue-bot/event/mock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	queuemock "github.com/yonesko/slack-queue-bot/queue/mock"
+	"github.com/yonesko/slack-queue-bot/status"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"github.com/yonesko/slack-queue-bot/usecase/impl"
+	usermock "github.com/yonesko/slack-queue-bot/user/mock"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type statusApiMock struct {
+	posted    int
+	updated   []string
+	pinned    []string
+	deleted   bool
+	pinFailed bool
+}
+
+func (s *statusApiMock) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
+	s.posted++
+	return "C" + channelID, strconv.Itoa(s.posted), nil
+}
+
+func (s *statusApiMock) UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	if s.deleted {
+		s.deleted = false
+		return "", "", "", slack.SlackResponse{Error: "message_not_found"}.Err()
+	}
+	s.updated = append(s.updated, timestamp)
+	return channelID, timestamp, "", nil
+}
+
+func (s *statusApiMock) AddPin(channel string, item slack.ItemRef) error {
+	if s.pinFailed {
+		s.pinFailed = false
+		return errors.New("internal_error")
+	}
+	s.pinned = append(s.pinned, item.Channel+"/"+item.Timestamp)
+	return nil
+}
+
+func TestStatusMessage_update(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	api := &statusApiMock{}
+	repository := &status.RepositoryMock{}
+	s := mockStatusMessage(api, repository, model.Queue{Entities: []model.QueueEntity{{UserId: "1"}, {UserId: "2"}}})
+
+	assert.Nil(t, s.update())
+	assert.Equal(t, status.Message{Channel: "Cqueue", Ts: "1", StatusChannel: "queue", Pinned: true}, repository.Message)
+	assert.Equal(t, []string{"Cqueue/1"}, api.pinned)
+
+	assert.Nil(t, s.update())
+	assert.Equal(t, []string{"1"}, api.updated, "message is updated in place")
+
+	api.deleted = true
+	assert.Nil(t, s.update())
+	assert.Equal(t, status.Message{Channel: "Cqueue", Ts: "2", StatusChannel: "queue", Pinned: true}, repository.Message, "deleted message is recreated")
+	assert.Equal(t, []string{"Cqueue/1", "Cqueue/2"}, api.pinned)
+}
+
+func TestStatusMessage_update_retries_pin(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	api := &statusApiMock{pinFailed: true}
+	repository := &status.RepositoryMock{}
+	s := mockStatusMessage(api, repository, model.Queue{})
+
+	assert.NotNil(t, s.update())
+	assert.Equal(t, status.Message{Channel: "Cqueue", Ts: "1", StatusChannel: "queue"}, repository.Message)
+	assert.Empty(t, api.pinned)
+
+	assert.Nil(t, s.update())
+	assert.Equal(t, []string{"1"}, api.updated, "message is not posted again")
+	assert.Equal(t, []string{"Cqueue/1"}, api.pinned)
+	assert.True(t, repository.Message.Pinned)
+}
+
+func TestStatusMessage_update_on_channel_change(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	api := &statusApiMock{}
+	repository := &status.RepositoryMock{Message: status.Message{Channel: "Cold", Ts: "7", StatusChannel: "old", Pinned: true}}
+	s := mockStatusMessage(api, repository, model.Queue{})
+
+	assert.Nil(t, s.update())
+	assert.Empty(t, api.updated)
+	assert.Equal(t, status.Message{Channel: "Cqueue", Ts: "1", StatusChannel: "queue", Pinned: true}, repository.Message)
+}
+
+func TestStatusMessage_render(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	s := mockStatusMessage(&statusApiMock{}, &status.RepositoryMock{}, model.Queue{})
+	queue := model.Queue{Entities: []model.QueueEntity{{UserId: "1"}, {UserId: "2"}}, HoldTs: s.clock.Now().Add(-time.Minute * 61), HolderIsSleeping: true}
+	assert.Equal(t, "*Queue*\n`1º` Joe (joe) :lock: 1 hour 1 minute :sleeping:\n`2º` Ann (ann) ", s.render(queue))
+	s.clock.(*clock.Fake).Advance(time.Minute)
+	assert.Equal(t, "*Queue*\n`1º` Joe (joe) :lock: 1 hour 2 minutes :sleeping:\n`2º` Ann (ann) ", s.render(queue), "hold time counts by the clock")
+	assert.Equal(t, "*Queue*\nQueue is empty", s.render(model.Queue{}))
+}
+
+func mockStatusMessage(api statusApi, repository status.Repository, queue model.Queue) *StatusMessage {
+	userRepository := usermock.NewUserRepository(map[string]model.User{
+		"1": {Id: "1", FullName: "Joe", DisplayName: "joe"},
+		"2": {Id: "2", FullName: "Ann", DisplayName: "ann"},
+	})
+	fake := clock.NewFake(time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC))
+	queueService := impl.NewQueueService(&queuemock.QueueRepository{Queue: queue}, &eventmock.QueueChangedEventBus{}, gateway.Mock{}, preference.NewLocalizerMock(), time.Minute*7, usecase.NotifyAbsent, fake)
+	formatter := preference.NewFormatter(preference.NewLocalizerMock(), userRepository)
+	return NewStatusMessage(ioutil.Discard, "queue", api, repository, queueService, userRepository, &estimate.RepositoryMock{}, formatter, nil, fake)
+}
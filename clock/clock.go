@@ -0,0 +1,59 @@
+package clock
+
+import "time"
+
+//Clock tells the time and schedules functions, tests use Fake to control the time
+type Clock interface {
+	Now() time.Time
+	//AfterFunc calls f in its own goroutine after d
+	AfterFunc(d time.Duration, f func()) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+type Timer interface {
+	//Stop tells if the timer is stopped before firing
+	Stop() bool
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+//Sleep blocks until d passes by c
+func Sleep(c Clock, d time.Duration) {
+	done := make(chan struct{})
+	c.AfterFunc(d, func() { close(done) })
+	<-done
+}
+
+//New is the clock of the system
+func New() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (s systemTicker) C() <-chan time.Time {
+	return s.ticker.C
+}
+
+func (s systemTicker) Stop() {
+	s.ticker.Stop()
+}
@@ -0,0 +1,118 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//Fake is a clock that stands still until Advance, timers fire in the goroutine calling Advance,
+//so tests see their effects right after it
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.schedule(d, 0, fn, nil)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{f.schedule(d, d, nil, make(chan time.Time, 1))}
+}
+
+func (f *Fake) schedule(d, period time.Duration, fn func(), c chan time.Time) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTimer{clock: f, at: f.now.Add(d), period: period, fn: fn, c: c}
+	f.timers = append(f.timers, t)
+	return t
+}
+
+//Advance moves the time forward by d firing due timers in order of their time
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	f.mu.Unlock()
+	for {
+		f.mu.Lock()
+		sort.SliceStable(f.timers, func(i, j int) bool { return f.timers[i].at.Before(f.timers[j].at) })
+		if len(f.timers) == 0 || f.timers[0].at.After(end) {
+			f.now = end
+			f.mu.Unlock()
+			return
+		}
+		t := f.timers[0]
+		f.now = t.at
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			f.timers = f.timers[1:]
+		}
+		now := f.now
+		f.mu.Unlock()
+		t.fire(now)
+	}
+}
+
+//Timers tells how many timers and tickers are waiting
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	at     time.Time
+	period time.Duration
+	fn     func()
+	c      chan time.Time
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.fn != nil {
+		t.fn()
+		return
+	}
+	//like a real ticker, ticks are dropped for a slow receiver
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct {
+	timer *fakeTimer
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.timer.c
+}
+
+func (t fakeTicker) Stop() {
+	t.timer.Stop()
+}
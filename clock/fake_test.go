@@ -0,0 +1,67 @@
+package clock
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFake_AfterFunc(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	var fired []string
+	var firedAt []time.Time
+	fake.AfterFunc(time.Minute*2, func() {
+		fired = append(fired, "2m")
+		firedAt = append(firedAt, fake.Now())
+	})
+	fake.AfterFunc(time.Minute, func() {
+		fired = append(fired, "1m")
+		firedAt = append(firedAt, fake.Now())
+	})
+	stopped := fake.AfterFunc(time.Minute, func() { fired = append(fired, "stopped") })
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	fake.Advance(time.Second * 59)
+	assert.Empty(t, fired)
+	fake.Advance(time.Minute * 5)
+	assert.Equal(t, []string{"1m", "2m"}, fired)
+	assert.Equal(t, []time.Time{start.Add(time.Minute), start.Add(time.Minute * 2)}, firedAt)
+	assert.Equal(t, start.Add(time.Minute*5+time.Second*59), fake.Now())
+	assert.Equal(t, 0, fake.Timers())
+}
+
+func TestFake_NewTicker(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	ticker := fake.NewTicker(time.Minute)
+
+	fake.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), <-ticker.C())
+	fake.Advance(time.Minute * 3)
+	assert.Equal(t, start.Add(time.Minute*2), <-ticker.C(), "ticks are dropped for a slow receiver")
+	assert.Empty(t, ticker.C())
+
+	ticker.Stop()
+	fake.Advance(time.Hour)
+	assert.Empty(t, ticker.C())
+}
+
+func TestSleep(t *testing.T) {
+	fake := NewFake(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	done := make(chan struct{})
+	go func() {
+		Sleep(fake, time.Minute)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return fake.Timers() == 1 }, time.Second, time.Millisecond)
+	fake.Advance(time.Second * 59)
+	select {
+	case <-done:
+		t.Fatal("woke up too early")
+	default:
+	}
+	fake.Advance(time.Second)
+	<-done
+}
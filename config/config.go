@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Version        string `yaml:"version"`
+	LogFile        string `yaml:"log_file"`
+	Language       string `yaml:"language"`
+	QueueDbFile    string `yaml:"queue_db_file"`
+	EstimateDbFile string `yaml:"estimate_db_file"`
+	HttpAddr       string `yaml:"http_addr"`
+	AdminApiToken  string `yaml:"admin_api_token"`
+	//DashboardToken lets in the read-only dashboard only, so the admin token doesn't end up in page URLs
+	DashboardToken string `yaml:"dashboard_token"`
+	CiWebhookToken string `yaml:"ci_webhook_token"`
+	WebhooksFile   string `yaml:"webhooks_file"`
+	ExecHooksFile  string `yaml:"exec_hooks_file"`
+	QueueName      string `yaml:"queue_name"`
+	//HoldSampleDbFile keeps the last holder change to estimate the next hold time with
+	HoldSampleDbFile string `yaml:"hold_sample_db_file"`
+	//PreferenceDbFile keeps languages and notification preferences chosen by users
+	PreferenceDbFile string `yaml:"preference_db_file"`
+	//StatusDbFile keeps the timestamp of the pinned status message
+	StatusDbFile string `yaml:"status_db_file"`
+	//OutboxDbFile keeps direct messages not delivered yet and dead letters
+	OutboxDbFile string `yaml:"outbox_db_file"`
+	//JournalDbFile keeps events not handled by every listener yet
+	JournalDbFile string `yaml:"journal_db_file"`
+	//StatusChannel gets a pinned message showing the queue, it is off if empty
+	StatusChannel string `yaml:"status_channel"`
+	//NotifyChannel is where users who have chosen channel delivery are mentioned, they get DMs if it is empty
+	NotifyChannel string `yaml:"notify_channel"`
+	//AdminUserIds can run admin commands like clean, everyone is an admin if it is empty
+	AdminUserIds []string `yaml:"admin_user_ids"`
+	//PresencePolicy is what to do with users away or in DND when it's their turn: notify, skip or wait
+	PresencePolicy string `yaml:"presence_policy"`
+	//CoalesceWindow is how long notifications to a user are buffered to be sent as one message, zero turns it off
+	CoalesceWindow time.Duration `yaml:"coalesce_window"`
+	//UserOauthAccessToken lets the bot set Slack status of the holder, it is off if empty
+	UserOauthAccessToken string `yaml:"user_oauth_access_token"`
+	//RateLimits protect the bot and Slack API quota from users spamming commands
+	RateLimits RateLimits `yaml:"rate_limits"`
+
+	QueueDefaults QueueSettings            `yaml:"queue_defaults"`
+	Queues        map[string]QueueSettings `yaml:"queues"`
+	//queueOverridden is set from environment and overrides any queue section
+	queueOverridden QueueSettings
+}
+
+//QueueSettings can be set globally in queue_defaults and overridden per queue, zero values are not overridden
+type QueueSettings struct {
+	//WaitForAck is how long the new holder has to ack before the turn is passed
+	WaitForAck time.Duration `yaml:"wait_for_ack"`
+	//MinHoldTime and MaxHoldTime bound hold times taken into estimate
+	MinHoldTime time.Duration `yaml:"min_hold_time"`
+	MaxHoldTime time.Duration `yaml:"max_hold_time"`
+}
+
+//RateLimits are per user budgets, read-only commands like show and help don't spend the mutating budget
+type RateLimits struct {
+	ReadOnly RateLimit `yaml:"read_only"`
+	Mutating RateLimit `yaml:"mutating"`
+}
+
+//RateLimit is a token bucket: Burst commands in a row, then one more every Every, zero Burst turns it off
+type RateLimit struct {
+	Burst int           `yaml:"burst"`
+	Every time.Duration `yaml:"every"`
+}
+
+func (s QueueSettings) merge(override QueueSettings) QueueSettings {
+	if override.WaitForAck != 0 {
+		s.WaitForAck = override.WaitForAck
+	}
+	if override.MinHoldTime != 0 {
+		s.MinHoldTime = override.MinHoldTime
+	}
+	if override.MaxHoldTime != 0 {
+		s.MaxHoldTime = override.MaxHoldTime
+	}
+	return s
+}
+
+func defaultConfig() Config {
+	return Config{
+		Version:        "1.9.0",
+		LogFile:        "slack-queue-bot.log",
+		Language:       "russian",
+		QueueDbFile:    "db/slack-queue-bot.db.json",
+		EstimateDbFile: "db/estimate.json",
+		HttpAddr:       ":8080",
+		WebhooksFile:   "webhooks.json",
+		ExecHooksFile:  "exec_hooks.json",
+		QueueName:      "default",
+		QueueDefaults: QueueSettings{
+			WaitForAck:  time.Minute * 7,
+			MinHoldTime: time.Minute * 15,
+			MaxHoldTime: time.Hour * 2,
+		},
+
+		HoldSampleDbFile: "db/hold_sample.json",
+		PreferenceDbFile: "db/preferences.json",
+		StatusDbFile:     "db/status.json",
+		OutboxDbFile:     "db/outbox.json",
+		JournalDbFile:    "db/journal.json",
+		PresencePolicy:   string(usecase.NotifyAbsent),
+		CoalesceWindow:   time.Second * 3,
+		RateLimits: RateLimits{
+			ReadOnly: RateLimit{Burst: 5, Every: time.Second * 10},
+			Mutating: RateLimit{Burst: 5, Every: time.Second * 30},
+		},
+	}
+}
+
+//Queue returns settings of the queue with per-queue section and environment applied
+func (c Config) Queue() QueueSettings {
+	return c.QueueDefaults.merge(c.Queues[c.QueueName]).merge(c.queueOverridden)
+}
+
+//Load reads filename if it exists, applies environment overrides and validates the result
+func Load(filename string) (Config, error) {
+	config := defaultConfig()
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return Config{}, fmt.Errorf("can't read config: %s", err)
+	}
+	if err == nil {
+		if err := yaml.UnmarshalStrict(bytes, &config); err != nil {
+			return Config{}, fmt.Errorf("can't parse config %s: %s", filename, err)
+		}
+	}
+	if err := config.overrideFromEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := config.validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+//envPrefix keeps overrides apart from standard variables like LANGUAGE
+const envPrefix = "QUEUE_BOT_"
+
+//overrideFromEnv applies QUEUE_BOT_ variables named after settings in upper case, rate_limits and queues can't be overridden
+func (c *Config) overrideFromEnv() error {
+	strs := map[string]*string{
+		"VERSION":          &c.Version,
+		"LOG_FILE":         &c.LogFile,
+		"LANGUAGE":         &c.Language,
+		"QUEUE_DB_FILE":    &c.QueueDbFile,
+		"ESTIMATE_DB_FILE": &c.EstimateDbFile,
+		"HTTP_ADDR":        &c.HttpAddr,
+		"ADMIN_API_TOKEN":  &c.AdminApiToken,
+		"DASHBOARD_TOKEN":  &c.DashboardToken,
+		"CI_WEBHOOK_TOKEN": &c.CiWebhookToken,
+		"WEBHOOKS_FILE":    &c.WebhooksFile,
+		"EXEC_HOOKS_FILE":  &c.ExecHooksFile,
+		"QUEUE_NAME":       &c.QueueName,
+
+		"HOLD_SAMPLE_DB_FILE": &c.HoldSampleDbFile,
+		"PREFERENCE_DB_FILE":  &c.PreferenceDbFile,
+		"STATUS_DB_FILE":      &c.StatusDbFile,
+		"OUTBOX_DB_FILE":      &c.OutboxDbFile,
+		"JOURNAL_DB_FILE":     &c.JournalDbFile,
+		"STATUS_CHANNEL":      &c.StatusChannel,
+		"NOTIFY_CHANNEL":      &c.NotifyChannel,
+		"PRESENCE_POLICY":     &c.PresencePolicy,
+
+		"USER_OAUTH_ACCESS_TOKEN": &c.UserOauthAccessToken,
+	}
+	for key, field := range strs {
+		if val, ok := os.LookupEnv(envPrefix + key); ok {
+			*field = val
+		}
+	}
+	if val, ok := os.LookupEnv(envPrefix + "ADMIN_USER_IDS"); ok {
+		c.AdminUserIds = splitList(val)
+	}
+	durations := map[string]*time.Duration{
+		"WAIT_FOR_ACK":  &c.queueOverridden.WaitForAck,
+		"MIN_HOLD_TIME": &c.queueOverridden.MinHoldTime,
+		"MAX_HOLD_TIME": &c.queueOverridden.MaxHoldTime,
+
+		"COALESCE_WINDOW": &c.CoalesceWindow,
+	}
+	for key, field := range durations {
+		val, ok := os.LookupEnv(envPrefix + key)
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid environment variable %s%s: %s", envPrefix, key, err)
+		}
+		*field = d
+	}
+	return nil
+}
+
+//splitList splits a comma-separated value dropping empty entries, so an empty value is an empty list
+func splitList(val string) []string {
+	var list []string
+	for _, s := range strings.Split(val, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func (c Config) validate() error {
+	var errs []string
+	if !i18n.IsSupported(c.Language) {
+		errs = append(errs, fmt.Sprintf("language '%s' is not supported", c.Language))
+	}
+	required := []struct {
+		name string
+		val  string
+	}{
+		{"version", c.Version},
+		{"log_file", c.LogFile},
+		{"queue_db_file", c.QueueDbFile},
+		{"estimate_db_file", c.EstimateDbFile},
+		{"hold_sample_db_file", c.HoldSampleDbFile},
+		{"preference_db_file", c.PreferenceDbFile},
+		{"status_db_file", c.StatusDbFile},
+		{"outbox_db_file", c.OutboxDbFile},
+		{"journal_db_file", c.JournalDbFile},
+		{"http_addr", c.HttpAddr},
+		{"queue_name", c.QueueName},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.val) == "" {
+			errs = append(errs, fmt.Sprintf("%s is required", r.name))
+		}
+	}
+	if !usecase.PresencePolicy(c.PresencePolicy).IsValid() {
+		errs = append(errs, fmt.Sprintf("presence_policy must be one of notify, skip, wait, got '%s'", c.PresencePolicy))
+	}
+	if c.UserOauthAccessToken != "" && !strings.HasPrefix(c.UserOauthAccessToken, "xoxp-") {
+		errs = append(errs, "user_oauth_access_token must be a user token starting with xoxp-")
+	}
+	if c.CoalesceWindow < 0 {
+		errs = append(errs, fmt.Sprintf("coalesce_window must not be negative, got %s", c.CoalesceWindow))
+	}
+	errs = append(errs, validateRateLimit("rate_limits.read_only", c.RateLimits.ReadOnly)...)
+	errs = append(errs, validateRateLimit("rate_limits.mutating", c.RateLimits.Mutating)...)
+	if c.QueueDbFile == c.EstimateDbFile {
+		errs = append(errs, "queue_db_file and estimate_db_file must differ")
+	}
+	errs = append(errs, validateQueue("queue_defaults", c.QueueDefaults)...)
+	var names []string
+	for name := range c.Queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		errs = append(errs, validateQueue("queues."+name, c.QueueDefaults.merge(c.Queues[name]))...)
+	}
+	if c.queueOverridden != (QueueSettings{}) {
+		errs = append(errs, validateQueue("environment", c.Queue())...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+	return nil
+}
+
+func validateQueue(section string, q QueueSettings) []string {
+	var errs []string
+	if q.WaitForAck <= 0 {
+		errs = append(errs, fmt.Sprintf("%s: wait_for_ack must be positive, got %s", section, q.WaitForAck))
+	}
+	if q.MinHoldTime < 0 {
+		errs = append(errs, fmt.Sprintf("%s: min_hold_time must not be negative, got %s", section, q.MinHoldTime))
+	}
+	if q.MaxHoldTime <= q.MinHoldTime {
+		errs = append(errs, fmt.Sprintf("%s: max_hold_time %s must be greater than min_hold_time %s", section, q.MaxHoldTime, q.MinHoldTime))
+	}
+	return errs
+}
+
+func validateRateLimit(section string, l RateLimit) []string {
+	var errs []string
+	if l.Burst < 0 {
+		errs = append(errs, fmt.Sprintf("%s: burst must not be negative, got %d", section, l.Burst))
+	}
+	if l.Burst > 0 && l.Every <= 0 {
+		errs = append(errs, fmt.Sprintf("%s: every must be positive, got %s", section, l.Every))
+	}
+	return errs
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad_defaults_without_file(t *testing.T) {
+	config, err := Load("no-such-file.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultConfig(), config)
+	assert.Equal(t, QueueSettings{time.Minute * 7, time.Minute * 15, time.Hour * 2}, config.Queue())
+}
+
+func TestLoad_per_queue_section_overrides_defaults(t *testing.T) {
+	filename := writeConfig(t, `
+language: english
+queue_name: staging
+queue_defaults:
+  wait_for_ack: 10m
+  max_hold_time: 3h
+queues:
+  staging:
+    wait_for_ack: 5m
+  prod:
+    min_hold_time: 30m
+`)
+	defer os.RemoveAll(filepath.Dir(filename))
+	config, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, "english", config.Language)
+	assert.Equal(t, "db/slack-queue-bot.db.json", config.QueueDbFile)
+	assert.Equal(t, QueueSettings{time.Minute * 5, time.Minute * 15, time.Hour * 3}, config.Queue())
+}
+
+func TestLoad_env_overrides_file(t *testing.T) {
+	filename := writeConfig(t, `
+log_file: from-file.log
+admin_api_token: admin
+queues:
+  default:
+    wait_for_ack: 5m
+`)
+	defer os.RemoveAll(filepath.Dir(filename))
+	setEnv(t, "QUEUE_BOT_LOG_FILE", "from-env.log")
+	defer os.Unsetenv("QUEUE_BOT_LOG_FILE")
+	setEnv(t, "QUEUE_BOT_WAIT_FOR_ACK", "1m")
+	defer os.Unsetenv("QUEUE_BOT_WAIT_FOR_ACK")
+	setEnv(t, "QUEUE_BOT_DASHBOARD_TOKEN", "wall")
+	defer os.Unsetenv("QUEUE_BOT_DASHBOARD_TOKEN")
+	config, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, "from-env.log", config.LogFile)
+	assert.Equal(t, "admin", config.AdminApiToken)
+	assert.Equal(t, "wall", config.DashboardToken, "the dashboard has its own token")
+	assert.Equal(t, time.Minute, config.Queue().WaitForAck)
+}
+
+func TestLoad_ignores_unprefixed_env(t *testing.T) {
+	setEnv(t, "LANGUAGE", "en_US:en")
+	defer os.Unsetenv("LANGUAGE")
+	setEnv(t, "VERSION", "")
+	defer os.Unsetenv("VERSION")
+	config, err := Load("no-such-file.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultConfig().Language, config.Language)
+	assert.Equal(t, defaultConfig().Version, config.Version)
+}
+
+func TestLoad_admin_user_ids_env(t *testing.T) {
+	setEnv(t, "QUEUE_BOT_ADMIN_USER_IDS", "")
+	defer os.Unsetenv("QUEUE_BOT_ADMIN_USER_IDS")
+	config, err := Load("no-such-file.yml")
+	assert.Nil(t, err)
+	assert.Empty(t, config.AdminUserIds)
+
+	setEnv(t, "QUEUE_BOT_ADMIN_USER_IDS", "U1, ,U2,")
+	config, err = Load("no-such-file.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"U1", "U2"}, config.AdminUserIds)
+}
+
+func TestLoad_invalid(t *testing.T) {
+	filename := writeConfig(t, `
+language: klingon
+log_file: ""
+user_oauth_access_token: xoxb-123
+queues:
+  staging:
+    min_hold_time: 3h
+`)
+	defer os.RemoveAll(filepath.Dir(filename))
+	_, err := Load(filename)
+	assert.EqualError(t, err, `invalid config:
+	language 'klingon' is not supported
+	log_file is required
+	user_oauth_access_token must be a user token starting with xoxp-
+	queues.staging: max_hold_time 2h0m0s must be greater than min_hold_time 3h0m0s`)
+}
+
+func TestLoad_invalid_rate_limits(t *testing.T) {
+	filename := writeConfig(t, `
+rate_limits:
+  read_only:
+    burst: -1
+  mutating:
+    burst: 3
+    every: 0s
+`)
+	defer os.RemoveAll(filepath.Dir(filename))
+	_, err := Load(filename)
+	assert.EqualError(t, err, `invalid config:
+	rate_limits.read_only: burst must not be negative, got -1
+	rate_limits.mutating: every must be positive, got 0s`)
+}
+
+func TestLoad_unknown_field(t *testing.T) {
+	filename := writeConfig(t, `wait_for_ack: 5m`)
+	defer os.RemoveAll(filepath.Dir(filename))
+	_, err := Load(filename)
+	assert.NotNil(t, err)
+}
+
+func TestLoad_invalid_env(t *testing.T) {
+	setEnv(t, "QUEUE_BOT_MAX_HOLD_TIME", "two hours")
+	defer os.Unsetenv("QUEUE_BOT_MAX_HOLD_TIME")
+	_, err := Load("no-such-file.yml")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid environment variable QUEUE_BOT_MAX_HOLD_TIME")
+}
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	filename := filepath.Join(dir, "slack-queue-bot.yml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(content), 0644))
+	return filename
+}
+
+func setEnv(t *testing.T, key, val string) {
+	assert.Nil(t, os.Setenv(key, val))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -20,15 +21,16 @@ func (e Estimate) AddOne(duration time.Duration) Estimate {
 	}
 }
 
-func (e Estimate) TimeToWait(before uint, holdStart time.Time) time.Duration {
+//TimeToWait is how long the one with before users ahead waits at the moment now
+func (e Estimate) TimeToWait(before uint, holdStart time.Time, now time.Time) time.Duration {
 	if before <= 0 {
 		return 0
 	}
-	return time.Duration(int64(before-1)*e.Average.Nanoseconds()) + e.avgRestOfHolding(holdStart)
+	return time.Duration(int64(before-1)*e.Average.Nanoseconds()) + e.avgRestOfHolding(holdStart, now)
 }
 
-func (e Estimate) avgRestOfHolding(holdStart time.Time) time.Duration {
-	holdRest := e.Average - time.Now().Sub(holdStart)
+func (e Estimate) avgRestOfHolding(holdStart time.Time, now time.Time) time.Duration {
+	holdRest := e.Average - now.Sub(holdStart)
 	if holdRest.Nanoseconds() < 0 {
 		return 0
 	}
@@ -44,13 +46,13 @@ type fileRepository struct {
 	filename string
 }
 
-func NewRepository() *fileRepository {
-	createDbIfNeed()
-	return &fileRepository{filename: "db/estimate.json"}
+func NewRepository(filename string) *fileRepository {
+	createDbIfNeed(filepath.Dir(filename))
+	return &fileRepository{filename: filename}
 }
-func createDbIfNeed() {
-	if _, err := os.Stat("db"); os.IsNotExist(err) {
-		err := os.Mkdir("db", os.ModePerm)
+func createDbIfNeed(dir string) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err := os.MkdirAll(dir, os.ModePerm)
 		if err != nil {
 			panic(err)
 		}
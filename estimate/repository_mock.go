@@ -12,3 +12,16 @@ func (r *RepositoryMock) Save(estimate Estimate) error {
 	r.estimate = estimate
 	return nil
 }
+
+type SampleRepositoryMock struct {
+	sample Sample
+}
+
+func (r *SampleRepositoryMock) Read() (Sample, error) {
+	return r.sample, nil
+}
+
+func (r *SampleRepositoryMock) Save(sample Sample) error {
+	r.sample = sample
+	return nil
+}
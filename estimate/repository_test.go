@@ -1,7 +1,6 @@
 package estimate
 
 import (
-	"bou.ke/monkey"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -23,23 +22,19 @@ func TestEstimate_addOne(t *testing.T) {
 
 func TestEstimate_YourHoldTsDontDependsOnNow(t *testing.T) {
 	now := time.Now()
-	patch := monkey.Patch(time.Now, func() time.Time { return now })
-	defer patch.Unpatch()
 
 	e := Estimate{Average: time.Minute * 45}
 	holdTs := now
 	yourHoldTs := now.Add(e.Average * 5)
-	assert.Equal(t, yourHoldTs, now.Add(e.TimeToWait(5, holdTs)))
+	assert.Equal(t, yourHoldTs, now.Add(e.TimeToWait(5, holdTs, now)))
 	now = now.Add(time.Minute)
-	assert.Equal(t, yourHoldTs, now.Add(e.TimeToWait(5, holdTs)))
+	assert.Equal(t, yourHoldTs, now.Add(e.TimeToWait(5, holdTs, now)))
 	now = now.Add(time.Minute * 30)
-	assert.Equal(t, yourHoldTs, now.Add(e.TimeToWait(5, holdTs)))
+	assert.Equal(t, yourHoldTs, now.Add(e.TimeToWait(5, holdTs, now)))
 }
 
 func TestEstimate_TimeToWait(t *testing.T) {
 	now := time.Now()
-	patch := monkey.Patch(time.Now, func() time.Time { return now })
-	defer patch.Unpatch()
 	e := Estimate{Average: time.Minute * 45}
 	type args struct {
 		before    uint
@@ -60,7 +55,7 @@ func TestEstimate_TimeToWait(t *testing.T) {
 	for _, tt := range tests {
 		name := fmt.Sprint(fmt.Sprintf("before %d %s", tt.args.before, now.Sub(tt.args.holdStart)))
 		t.Run(name, func(t *testing.T) {
-			if got := e.TimeToWait(tt.args.before, tt.args.holdStart); got != tt.want {
+			if got := e.TimeToWait(tt.args.before, tt.args.holdStart, now); got != tt.want {
 				t.Errorf("TimeToWait() = %v, want %v", got, tt.want)
 			}
 		})
@@ -0,0 +1,76 @@
+package estimate
+
+import (
+	"encoding/json"
+	"github.com/yonesko/slack-queue-bot/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//Sample is the last holder change, the next one gives a hold time to estimate with
+type Sample struct {
+	Holder *model.NewHolderEvent `json:"holder"`
+	//Key is the idempotency key of Holder, empty if the event came without one
+	Key string `json:"key"`
+}
+
+type SampleRepository interface {
+	Read() (Sample, error)
+	Save(sample Sample) error
+}
+
+type fileSampleRepository struct {
+	filename string
+}
+
+func NewSampleRepository(filename string) *fileSampleRepository {
+	createDbIfNeed(filepath.Dir(filename))
+	return &fileSampleRepository{filename: filename}
+}
+
+//Save writes a temp file and renames it over the old one, so a crash never leaves a torn sample
+func (f *fileSampleRepository) Save(sample Sample) error {
+	bytes, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.filename), "."+filepath.Base(f.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(bytes)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (f *fileSampleRepository) Read() (Sample, error) {
+	bytes, err := ioutil.ReadFile(f.filename)
+	if os.IsNotExist(err) {
+		return Sample{}, nil
+	}
+	if err != nil {
+		return Sample{}, err
+	}
+	sample := &Sample{}
+	err = json.Unmarshal(bytes, sample)
+	if err != nil {
+		return Sample{}, err
+	}
+	return *sample, nil
+}
@@ -0,0 +1,52 @@
+package estimate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSampleRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sample")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	repository := NewSampleRepository(filepath.Join(dir, "db", "hold_sample.json"))
+
+	sample, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Sample{}, sample, "missing file is an empty sample")
+
+	sample = Sample{
+		Holder: &model.NewHolderEvent{CurrentHolderUserId: "1", PrevHolderUserId: "2", Ts: time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)},
+		Key:    "event-7",
+	}
+	assert.Nil(t, repository.Save(sample))
+	read, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, sample, read)
+
+	assert.Nil(t, repository.Save(Sample{Holder: &model.NewHolderEvent{CurrentHolderUserId: "3"}}))
+	read, err = repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, "3", read.Holder.CurrentHolderUserId, "the sample is overwritten")
+	assert.Empty(t, read.Key, "an event may come without a key")
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "db"))
+	assert.Nil(t, err)
+	assert.Len(t, files, 1, "no temporary files are left")
+	assert.Equal(t, os.FileMode(0644), files[0].Mode())
+}
+
+func TestFileSampleRepository_corrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sample")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "hold_sample.json")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("{"), 0644))
+	_, err = NewSampleRepository(filename).Read()
+	assert.NotNil(t, err)
+}
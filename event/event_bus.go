@@ -1,48 +1,346 @@
 package event
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/yonesko/slack-queue-bot/clock"
 	"github.com/yonesko/slack-queue-bot/event/listener"
+	"github.com/yonesko/slack-queue-bot/journal"
 	"github.com/yonesko/slack-queue-bot/model"
 	"io"
 	"log"
+	"reflect"
+	"runtime/debug"
+	"sync"
 )
 
 type QueueChangedEventBus interface {
 	Send(event interface{})
 }
 
-func NewQueueChangedEventBus(lumberWriter io.Writer, newHolderEventListeners []listener.NewHolderEventListener, newSecondEventListeners []listener.NewSecondEventListener, deletedEventListeners []listener.DeletedEventListener) QueueChangedEventBus {
-	return &queueChangedEventBus{
-		logger:                  log.New(lumberWriter, "event-bus: ", log.Lshortfile|log.LstdFlags),
-		newHolderEventListeners: newHolderEventListeners,
-		newSecondEventListeners: newSecondEventListeners,
-		deletedEventListeners:   deletedEventListeners,
+//restorable are types of events the journal can be replayed with, events of other types are delivered once
+var restorable = typesByName(
+	model.NewHolderEvent{}, model.NewSecondEvent{}, model.DeletedEvent{}, model.PositionChangedEvent{},
+	model.AddedEvent{}, model.PassedEvent{}, model.AckedEvent{}, model.CleanedEvent{}, model.HolderTimedOutEvent{}, model.PoppedEvent{},
+	model.ReleasedEvent{},
+)
+
+func typesByName(events ...interface{}) map[string]reflect.Type {
+	types := map[string]reflect.Type{}
+	for _, event := range events {
+		types[reflect.TypeOf(event).Name()] = reflect.TypeOf(event)
 	}
+	return types
 }
 
-type queueChangedEventBus struct {
-	logger                  *log.Logger
-	newHolderEventListeners []listener.NewHolderEventListener
-	newSecondEventListeners []listener.NewSecondEventListener
-	deletedEventListeners   []listener.DeletedEventListener
+//Bus delivers events to listeners subscribed to their types, every listener has its own worker,
+//so it gets events one by one in order of sending and a slow or panicking listener doesn't affect others.
+//Events are saved to the journal before delivery and replayed on Start to a listener.KeyedEventListener
+//that didn't handle them, so it gets an event at least once and tells duplicates by the key,
+//notification listeners pass the key to the outbox, it drops messages sent again.
+//Other listeners aren't in the journal, they get an event at most once
+type Bus struct {
+	ctx        context.Context
+	repository journal.Repository
+	//mu keeps the order of journal records and deliveries the same
+	mu      sync.Mutex
+	workers []*worker
+	started bool
+	//lastSeq is read from the journal by the first event or Start
+	lastSeq   int64
+	seqLoaded bool
+	//appended counts records since the journal was compacted
+	appended int
+	logger   *log.Logger
+	clock    clock.Clock
+}
+
+//compactEvery is how many records are appended to the journal before records every listener is done with are dropped
+const compactEvery = 100
+
+//NewQueueChangedEventBus creates a bus, its workers stop when ctx is done
+func NewQueueChangedEventBus(ctx context.Context, lumberWriter io.Writer, repository journal.Repository, clock clock.Clock) *Bus {
+	return &Bus{
+		ctx:        ctx,
+		repository: repository,
+		logger:     log.New(lumberWriter, "event-bus: ", log.Lshortfile|log.LstdFlags),
+		clock:      clock,
+	}
+}
+
+//Subscribe delivers events of the same types as events to l, l gets every event if events are omitted;
+//name identifies the listener in the journal, so it must be the same across restarts.
+//All listeners are subscribed before Start
+func (b *Bus) Subscribe(name string, l listener.EventListener, events ...interface{}) {
+	w := &worker{
+		name:     name,
+		listener: l,
+		types:    map[reflect.Type]bool{},
+		wake:     make(chan struct{}, 1),
+		bus:      b,
+	}
+	for _, event := range events {
+		w.types[reflect.TypeOf(event)] = true
+	}
+	_, w.durable = l.(listener.KeyedEventListener)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started {
+		panic(fmt.Sprintf("%s is subscribed after start", name))
+	}
+	b.workers = append(b.workers, w)
 }
 
-func (q *queueChangedEventBus) Send(event interface{}) {
-	q.logger.Printf("received event %#v", event)
-	switch event := event.(type) {
-	case model.NewHolderEvent:
-		for _, l := range q.newHolderEventListeners {
-			go l.Fire(event)
+//Start replays events every listener didn't handle before the restart and starts delivering new ones
+func (b *Bus) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.started = true
+	j, err := b.repository.Read()
+	if err != nil {
+		b.logger.Printf("can't read journal, nothing is replayed: %s", err)
+	}
+	if err == nil {
+		if !b.seqLoaded {
+			b.lastSeq, b.seqLoaded = j.LastSeq, true
 		}
-	case model.NewSecondEvent:
-		for _, l := range q.newSecondEventListeners {
-			go l.Fire(event)
+		for _, w := range b.durableWorkers() {
+			seq, ok := j.Checkpoints[w.name]
+			if !ok {
+				//a new listener starts with new events
+				seq = j.LastSeq
+				if err := b.repository.Checkpoint(w.name, seq); err != nil {
+					b.logger.Printf("can't save checkpoint of %s: %s", w.name, err)
+				}
+			}
+			w.checkpoint, w.doneSeq = seq, seq
+		}
+		b.compact()
+	}
+
+	for _, record := range j.Records {
+		event, err := restore(record)
+		if err != nil {
+			b.logger.Printf("can't replay %d: %s", record.Seq, err)
+			continue
+		}
+		for _, w := range b.durableWorkers() {
+			if record.Seq > w.checkpoint {
+				b.logger.Printf("replay %d %s to %s", record.Seq, record.Type, w.name)
+				w.push(envelope{seq: record.Seq, event: event})
+			}
+		}
+	}
+	for _, w := range b.workers {
+		go w.run(b.ctx)
+	}
+}
+
+func restore(record journal.Record) (interface{}, error) {
+	t, ok := restorable[record.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %s", record.Type)
+	}
+	event := reflect.New(t)
+	if err := json.Unmarshal(record.Event, event.Interface()); err != nil {
+		return nil, err
+	}
+	return event.Elem().Interface(), nil
+}
+
+func (b *Bus) Send(event interface{}) {
+	if b.ctx.Err() != nil {
+		b.logger.Printf("bus is stopped, drop event %#v", event)
+		return
+	}
+	b.logger.Printf("received event %#v", event)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	seq := b.save(event)
+	for _, w := range b.workers {
+		w.push(envelope{seq: seq, event: event})
+	}
+}
+
+//save appends event to the journal and tells its seq, events are still delivered if the journal fails
+func (b *Bus) save(event interface{}) int64 {
+	if !b.seqLoaded {
+		j, err := b.repository.Read()
+		if err != nil {
+			b.logger.Printf("can't read journal, %T won't be replayed: %s", event, err)
+			return 0
 		}
-	case model.DeletedEvent:
-		for _, l := range q.deletedEventListeners {
-			go l.Fire(event)
+		b.lastSeq, b.seqLoaded = j.LastSeq, true
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		b.logger.Printf("can't marshal %#v, it won't be replayed: %s", event, err)
+		return 0
+	}
+	b.lastSeq++
+	record := journal.Record{Seq: b.lastSeq, Type: reflect.TypeOf(event).Name(), Ts: b.clock.Now(), Event: body}
+	if err := b.repository.Append(record); err != nil {
+		b.logger.Printf("can't save journal, %T won't be replayed: %s", event, err)
+		return 0
+	}
+	b.appended++
+	if b.appended >= compactEvery {
+		b.compact()
+	}
+	return record.Seq
+}
+
+//compact drops records every listener is done with, mu must be acquired by the caller
+func (b *Bus) compact() {
+	b.appended = 0
+	checkpoints := map[string]int64{}
+	for _, w := range b.durableWorkers() {
+		checkpoints[w.name] = w.done()
+	}
+	if err := b.repository.Compact(checkpoints); err != nil {
+		b.logger.Printf("can't compact journal: %s", err)
+	}
+}
+
+func (b *Bus) durableWorkers() []*worker {
+	var workers []*worker
+	for _, w := range b.workers {
+		if w.durable {
+			workers = append(workers, w)
 		}
+	}
+	return workers
+}
+
+//checkOff saves the checkpoint of w, workers save their checkpoints independently
+func (b *Bus) checkOff(w *worker, seq int64) {
+	if err := b.repository.Checkpoint(w.name, seq); err != nil {
+		b.logger.Printf("can't save checkpoint, %d may be redelivered to %s: %s", seq, w.name, err)
+		return
+	}
+	w.mu.Lock()
+	w.doneSeq = seq
+	w.mu.Unlock()
+}
+
+//Failures tells how many events every listener failed to handle
+func (b *Bus) Failures() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failures := map[string]int{}
+	for _, w := range b.workers {
+		failures[w.name] += w.failed()
+	}
+	return failures
+}
+
+//envelope is an event with its seq in the journal, seq is 0 if the event isn't saved
+type envelope struct {
+	seq   int64
+	event interface{}
+}
+
+type worker struct {
+	name     string
+	listener listener.EventListener
+	//types of events to deliver, empty means every event
+	types map[reflect.Type]bool
+	mu    sync.Mutex
+	inbox []envelope
+	//durable workers have checkpoints in the journal and get events again after a restart
+	durable bool
+	//checkpoint is seq of the last event the worker was done with before Start
+	checkpoint int64
+	//doneSeq is seq of the last event the worker is done with
+	doneSeq  int64
+	failures int
+	wake     chan struct{}
+	bus      *Bus
+}
+
+func (w *worker) accepts(event interface{}) bool {
+	return len(w.types) == 0 || w.types[reflect.TypeOf(event)]
+}
+
+//push never blocks, so a slow listener doesn't hold up the sender
+func (w *worker) push(e envelope) {
+	w.mu.Lock()
+	w.inbox = append(w.inbox, e)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
 	default:
-		q.logger.Printf("unknown event %v", event)
 	}
 }
+
+func (w *worker) pop() (envelope, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.inbox) == 0 {
+		return envelope{}, false
+	}
+	e := w.inbox[0]
+	w.inbox = w.inbox[1:]
+	return e, true
+}
+
+func (w *worker) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			w.bus.logger.Printf("%s is stopped, %d events undelivered", w.name, len(w.inbox))
+			w.mu.Unlock()
+			return
+		case <-w.wake:
+		}
+		for ctx.Err() == nil {
+			e, ok := w.pop()
+			if !ok {
+				break
+			}
+			if w.accepts(e.event) {
+				w.deliver(e)
+			}
+			//events of other types are checked off too, so the journal can drop them
+			if e.seq > 0 && w.durable {
+				w.bus.checkOff(w, e.seq)
+			}
+		}
+	}
+}
+
+func (w *worker) deliver(e envelope) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.mu.Lock()
+			w.failures++
+			failures := w.failures
+			w.mu.Unlock()
+			w.bus.logger.Printf("%s panicked on %#v, %d failures so far: %v\n%s", w.name, e.event, failures, r, debug.Stack())
+		}
+	}()
+	if keyed, ok := w.listener.(listener.KeyedEventListener); ok && e.seq > 0 {
+		keyed.FireKeyed(key(e.seq), e.event)
+		return
+	}
+	w.listener.Fire(e.event)
+}
+
+func (w *worker) done() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.doneSeq
+}
+
+func (w *worker) failed() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failures
+}
+
+//key is the idempotency key of the event with seq, a redelivered event has the same key
+func key(seq int64) string {
+	return fmt.Sprintf("event-%d", seq)
+}
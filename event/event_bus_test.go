@@ -0,0 +1,303 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/event/listener"
+	"github.com/yonesko/slack-queue-bot/journal"
+	"github.com/yonesko/slack-queue-bot/model"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+type chanListener chan interface{}
+
+func (c chanListener) Fire(event interface{}) {
+	c <- event
+}
+
+type panickingListener struct{}
+
+func (panickingListener) Fire(event interface{}) {
+	panic("listener is broken")
+}
+
+func receive(t *testing.T, c chanListener) interface{} {
+	select {
+	case event := <-c:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("event isn't delivered")
+		return nil
+	}
+}
+
+func TestBus_delivers_in_order(t *testing.T) {
+	bus := NewQueueChangedEventBus(context.Background(), ioutil.Discard, &journal.RepositoryMock{}, clock.New())
+	c := make(chanListener)
+	bus.Subscribe("test", c)
+	bus.Start()
+	for i := 0; i < 100; i++ {
+		bus.Send(i)
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, i, receive(t, c))
+	}
+}
+
+func TestBus_delivers_subscribed_types(t *testing.T) {
+	bus := NewQueueChangedEventBus(context.Background(), ioutil.Discard, &journal.RepositoryMock{}, clock.New())
+	holders, all := make(chanListener, 10), make(chanListener, 10)
+	bus.Subscribe("holders", holders, model.NewHolderEvent{})
+	bus.Subscribe("all", all)
+	bus.Start()
+
+	bus.Send(model.DeletedEvent{DeletedUserId: "1"})
+	bus.Send(model.NewHolderEvent{CurrentHolderUserId: "2"})
+
+	assert.Equal(t, model.NewHolderEvent{CurrentHolderUserId: "2"}, receive(t, holders))
+	assert.Equal(t, model.DeletedEvent{DeletedUserId: "1"}, receive(t, all))
+	assert.Equal(t, model.NewHolderEvent{CurrentHolderUserId: "2"}, receive(t, all))
+	assert.Empty(t, holders)
+}
+
+func TestBus_recovers_panics(t *testing.T) {
+	bus := NewQueueChangedEventBus(context.Background(), ioutil.Discard, &journal.RepositoryMock{}, clock.New())
+	c := make(chanListener, 10)
+	bus.Subscribe("broken", panickingListener{})
+	bus.Subscribe("test", c)
+	bus.Start()
+
+	bus.Send(1)
+	bus.Send(2)
+	assert.Equal(t, 1, receive(t, c))
+	assert.Equal(t, 2, receive(t, c))
+	assert.Eventually(t, func() bool { return bus.Failures()["broken"] == 2 }, time.Second, time.Millisecond*10)
+	assert.Equal(t, 0, bus.Failures()["test"])
+}
+
+func TestBus_stops_on_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := NewQueueChangedEventBus(ctx, ioutil.Discard, &journal.RepositoryMock{}, clock.New())
+	c := make(chanListener, 10)
+	bus.Subscribe("test", c)
+	bus.Start()
+	bus.Send(1)
+	assert.Equal(t, 1, receive(t, c))
+
+	cancel()
+	bus.Send(2)
+	select {
+	case event := <-c:
+		t.Fatalf("%v is delivered after cancel", event)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+type keyedListener chan string
+
+func (k keyedListener) Fire(event interface{}) {
+	k <- ""
+}
+
+func (k keyedListener) FireKeyed(key string, event interface{}) {
+	k <- key
+}
+
+//keyedChanListener gets events like chanListener, being keyed it is in the journal
+type keyedChanListener struct{ chanListener }
+
+func (k keyedChanListener) FireKeyed(key string, event interface{}) {
+	k.chanListener <- event
+}
+
+func newKeyedChanListener() keyedChanListener {
+	return keyedChanListener{make(chanListener, compactEvery)}
+}
+
+func TestBus_replays_undelivered(t *testing.T) {
+	repository := &journal.RepositoryMock{}
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := NewQueueChangedEventBus(ctx, ioutil.Discard, repository, clock.New())
+	holders, deleted, plain := newKeyedChanListener(), newKeyedChanListener(), make(chanListener, 10)
+	bus.Subscribe("holders", holders, model.NewHolderEvent{})
+	bus.Subscribe("deleted", deleted, model.DeletedEvent{})
+	bus.Subscribe("plain", plain)
+	bus.Start()
+	bus.Send(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	assert.Equal(t, model.NewHolderEvent{CurrentHolderUserId: "1"}, receive(t, holders.chanListener))
+	assert.Equal(t, model.NewHolderEvent{CurrentHolderUserId: "1"}, receive(t, plain))
+	assert.Eventually(t, func() bool {
+		j, _ := repository.Read()
+		return j.Checkpoints["deleted"] == 1 && j.Checkpoints["holders"] == 1
+	}, time.Second, time.Millisecond*10, "every keyed listener saves its checkpoint")
+	j, _ := repository.Read()
+	assert.NotContains(t, j.Checkpoints, "plain", "a listener that can't tell duplicates isn't in the journal")
+
+	//the process dies before listeners get the event
+	cancel()
+	assert.Nil(t, repository.Append(journal.Record{Seq: 2, Type: "NewHolderEvent", Event: []byte(`{"current_holder_user_id":"2"}`)}))
+
+	bus = NewQueueChangedEventBus(context.Background(), ioutil.Discard, repository, clock.New())
+	holders, deleted, plain = newKeyedChanListener(), newKeyedChanListener(), make(chanListener, 10)
+	keyed := make(keyedListener, 10)
+	bus.Subscribe("holders", holders, model.NewHolderEvent{})
+	bus.Subscribe("deleted", deleted, model.DeletedEvent{})
+	bus.Subscribe("plain", plain)
+	bus.Subscribe("keyed", keyed)
+	bus.Start()
+	assert.Equal(t, model.NewHolderEvent{CurrentHolderUserId: "2"}, receive(t, holders.chanListener))
+	assert.Empty(t, keyed, "a new listener starts with new events")
+	assert.Empty(t, plain, "events aren't replayed to a listener that can't tell duplicates")
+	j, _ = repository.Read()
+	assert.Equal(t, []int64{2}, seqs(j.Records), "records every listener is done with are dropped on start")
+
+	bus.Send(model.DeletedEvent{DeletedUserId: "3"})
+	assert.Equal(t, model.DeletedEvent{DeletedUserId: "3"}, receive(t, deleted.chanListener))
+	assert.Equal(t, model.DeletedEvent{DeletedUserId: "3"}, receive(t, plain))
+	select {
+	case key := <-keyed:
+		assert.Equal(t, "event-3", key)
+	case <-time.After(time.Second):
+		t.Fatal("event isn't delivered")
+	}
+}
+
+func seqs(records []journal.Record) []int64 {
+	var seqs []int64
+	for _, r := range records {
+		seqs = append(seqs, r.Seq)
+	}
+	return seqs
+}
+
+func TestBus_journal_record_time(t *testing.T) {
+	repository := &journal.RepositoryMock{}
+	fake := clock.NewFake(time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC))
+	bus := NewQueueChangedEventBus(context.Background(), ioutil.Discard, repository, fake)
+	holders := newKeyedChanListener()
+	bus.Subscribe("holders", holders, model.NewHolderEvent{})
+	bus.Start()
+	bus.Send(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	fake.Advance(time.Minute)
+	bus.Send(model.NewHolderEvent{CurrentHolderUserId: "2"})
+	receive(t, holders.chanListener)
+	receive(t, holders.chanListener)
+
+	j, err := repository.Read()
+	assert.Nil(t, err)
+	var ts []time.Time
+	for _, r := range j.Records {
+		ts = append(ts, r.Ts)
+	}
+	assert.Equal(t, []time.Time{fake.Now().Add(-time.Minute), fake.Now()}, ts, "records are stamped by the clock")
+}
+
+func TestBus_compacts_journal(t *testing.T) {
+	repository := &journal.RepositoryMock{}
+	bus := NewQueueChangedEventBus(context.Background(), ioutil.Discard, repository, clock.New())
+	c, gone := newKeyedChanListener(), newKeyedChanListener()
+	bus.Subscribe("test", c)
+	bus.Subscribe("gone-after-restart", gone)
+	bus.Start()
+	for i := 0; i < compactEvery-1; i++ {
+		bus.Send(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	}
+	assert.Eventually(t, func() bool {
+		j, _ := repository.Read()
+		return j.Checkpoints["test"] == compactEvery-1 && j.Checkpoints["gone-after-restart"] == compactEvery-1
+	}, time.Second, time.Millisecond*10)
+	j, _ := repository.Read()
+	assert.Len(t, j.Records, compactEvery-1, "records are appended")
+
+	bus.Send(model.NewHolderEvent{CurrentHolderUserId: "2"})
+	j, _ = repository.Read()
+	assert.Equal(t, []int64{compactEvery}, seqs(j.Records), "records every listener is done with are dropped")
+	assert.Eventually(t, func() bool {
+		j, _ := repository.Read()
+		return j.Checkpoints["test"] == compactEvery && j.Checkpoints["gone-after-restart"] == compactEvery
+	}, time.Second, time.Millisecond*10)
+
+	bus = NewQueueChangedEventBus(context.Background(), ioutil.Discard, repository, clock.New())
+	bus.Subscribe("test", newKeyedChanListener())
+	bus.Start()
+	j, _ = repository.Read()
+	assert.Equal(t, map[string]int64{"test": compactEvery}, j.Checkpoints, "checkpoints of listeners that are gone are dropped")
+	bus.Send(model.NewHolderEvent{CurrentHolderUserId: "3"})
+	j, _ = repository.Read()
+	assert.Equal(t, int64(compactEvery+1), j.LastSeq, "seq goes on after a restart")
+}
+
+type addedRecorder chanListener
+
+func (r addedRecorder) Fire(ev model.AddedEvent) { r <- ev }
+
+type passedRecorder chanListener
+
+func (r passedRecorder) Fire(ev model.PassedEvent) { r <- ev }
+
+type ackedRecorder chanListener
+
+func (r ackedRecorder) Fire(ev model.AckedEvent) { r <- ev }
+
+type cleanedRecorder chanListener
+
+func (r cleanedRecorder) Fire(ev model.CleanedEvent) { r <- ev }
+
+type holderTimedOutRecorder chanListener
+
+func (r holderTimedOutRecorder) Fire(ev model.HolderTimedOutEvent) { r <- ev }
+
+type poppedRecorder chanListener
+
+func (r poppedRecorder) Fire(ev model.PoppedEvent) { r <- ev }
+
+type releasedRecorder chanListener
+
+func (r releasedRecorder) Fire(ev model.ReleasedEvent) { r <- ev }
+
+func TestBus_operation_adapters(t *testing.T) {
+	bus := NewQueueChangedEventBus(context.Background(), ioutil.Discard, &journal.RepositoryMock{}, clock.New())
+	operation := model.QueueOperation{AuthorUserId: "1", Queue: []string{"1"}, Ts: time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)}
+	events := []interface{}{
+		model.AddedEvent{QueueOperation: operation, UserId: "1"},
+		model.PassedEvent{QueueOperation: operation, ToUserId: "2"},
+		model.AckedEvent{QueueOperation: operation},
+		model.CleanedEvent{QueueOperation: operation},
+		model.HolderTimedOutEvent{QueueOperation: operation, NewHolderUserId: "2"},
+		model.PoppedEvent{QueueOperation: operation, PoppedUserId: "1"},
+		model.ReleasedEvent{QueueOperation: operation, ReleasedUserId: "1", Outcome: "success"},
+	}
+	recorders := []chanListener{make(chanListener, 10), make(chanListener, 10), make(chanListener, 10), make(chanListener, 10), make(chanListener, 10), make(chanListener, 10), make(chanListener, 10)}
+	adapters := []listener.EventListener{
+		listener.OnAdded(addedRecorder(recorders[0])),
+		listener.OnPassed(passedRecorder(recorders[1])),
+		listener.OnAcked(ackedRecorder(recorders[2])),
+		listener.OnCleaned(cleanedRecorder(recorders[3])),
+		listener.OnHolderTimedOut(holderTimedOutRecorder(recorders[4])),
+		listener.OnPopped(poppedRecorder(recorders[5])),
+		listener.OnReleased(releasedRecorder(recorders[6])),
+	}
+	for i, adapter := range adapters {
+		//adapters get every event, so they have to skip other types themselves
+		bus.Subscribe(fmt.Sprintf("adapter-%d", i), adapter)
+	}
+	all := make(chanListener, 10)
+	bus.Subscribe("all", all)
+	bus.Start()
+	bus.Send(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	for _, event := range events {
+		bus.Send(event)
+	}
+	for range events {
+		receive(t, all)
+	}
+	receive(t, all)
+	for i, event := range events {
+		assert.Equal(t, event, receive(t, recorders[i]))
+		assert.Empty(t, recorders[i], "%T gets its own events only", adapters[i])
+	}
+}
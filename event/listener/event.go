@@ -0,0 +1,148 @@
+package listener
+
+import "github.com/yonesko/slack-queue-bot/model"
+
+//EventListener receives events sent to the bus
+type EventListener interface {
+	Fire(event interface{})
+}
+
+//KeyedEventListener gets the idempotency key of every event instead of Fire,
+//the bus delivers an event to it at least once and a redelivered event has the same key,
+//other listeners get an event at most once as they can't tell duplicates
+type KeyedEventListener interface {
+	EventListener
+	FireKeyed(key string, event interface{})
+}
+
+//KeyedNewHolderEventListener is a NewHolderEventListener that tells duplicates by the key
+type KeyedNewHolderEventListener interface {
+	NewHolderEventListener
+	FireKeyed(key string, ev model.NewHolderEvent)
+}
+
+//OnNewHolder adapts l to the bus, other events are ignored, the adapter is keyed if l is
+func OnNewHolder(l NewHolderEventListener) EventListener {
+	if keyed, ok := l.(KeyedNewHolderEventListener); ok {
+		return onKeyedNewHolder{onNewHolder{l}, keyed}
+	}
+	return onNewHolder{l}
+}
+
+type onNewHolder struct{ l NewHolderEventListener }
+
+func (o onNewHolder) Fire(event interface{}) {
+	if ev, ok := event.(model.NewHolderEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+type onKeyedNewHolder struct {
+	onNewHolder
+	keyed KeyedNewHolderEventListener
+}
+
+func (o onKeyedNewHolder) FireKeyed(key string, event interface{}) {
+	if ev, ok := event.(model.NewHolderEvent); ok {
+		o.keyed.FireKeyed(key, ev)
+	}
+}
+
+//KeyedNewSecondEventListener is a NewSecondEventListener that tells duplicates by the key
+type KeyedNewSecondEventListener interface {
+	NewSecondEventListener
+	FireKeyed(key string, ev model.NewSecondEvent)
+}
+
+//OnNewSecond adapts l to the bus, other events are ignored, the adapter is keyed if l is
+func OnNewSecond(l NewSecondEventListener) EventListener {
+	if keyed, ok := l.(KeyedNewSecondEventListener); ok {
+		return onKeyedNewSecond{onNewSecond{l}, keyed}
+	}
+	return onNewSecond{l}
+}
+
+type onNewSecond struct{ l NewSecondEventListener }
+
+func (o onNewSecond) Fire(event interface{}) {
+	if ev, ok := event.(model.NewSecondEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+type onKeyedNewSecond struct {
+	onNewSecond
+	keyed KeyedNewSecondEventListener
+}
+
+func (o onKeyedNewSecond) FireKeyed(key string, event interface{}) {
+	if ev, ok := event.(model.NewSecondEvent); ok {
+		o.keyed.FireKeyed(key, ev)
+	}
+}
+
+//KeyedDeletedEventListener is a DeletedEventListener that tells duplicates by the key
+type KeyedDeletedEventListener interface {
+	DeletedEventListener
+	FireKeyed(key string, ev model.DeletedEvent)
+}
+
+//OnDeleted adapts l to the bus, other events are ignored, the adapter is keyed if l is
+func OnDeleted(l DeletedEventListener) EventListener {
+	if keyed, ok := l.(KeyedDeletedEventListener); ok {
+		return onKeyedDeleted{onDeleted{l}, keyed}
+	}
+	return onDeleted{l}
+}
+
+type onDeleted struct{ l DeletedEventListener }
+
+func (o onDeleted) Fire(event interface{}) {
+	if ev, ok := event.(model.DeletedEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+type onKeyedDeleted struct {
+	onDeleted
+	keyed KeyedDeletedEventListener
+}
+
+func (o onKeyedDeleted) FireKeyed(key string, event interface{}) {
+	if ev, ok := event.(model.DeletedEvent); ok {
+		o.keyed.FireKeyed(key, ev)
+	}
+}
+
+//KeyedPositionChangedEventListener is a PositionChangedEventListener that tells duplicates by the key
+type KeyedPositionChangedEventListener interface {
+	PositionChangedEventListener
+	FireKeyed(key string, ev model.PositionChangedEvent)
+}
+
+//OnPositionChanged adapts l to the bus, other events are ignored, the adapter is keyed if l is
+func OnPositionChanged(l PositionChangedEventListener) EventListener {
+	if keyed, ok := l.(KeyedPositionChangedEventListener); ok {
+		return onKeyedPositionChanged{onPositionChanged{l}, keyed}
+	}
+	return onPositionChanged{l}
+}
+
+type onPositionChanged struct{ l PositionChangedEventListener }
+
+func (o onPositionChanged) Fire(event interface{}) {
+	if ev, ok := event.(model.PositionChangedEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+type onKeyedPositionChanged struct {
+	onPositionChanged
+	keyed KeyedPositionChangedEventListener
+}
+
+func (o onKeyedPositionChanged) FireKeyed(key string, event interface{}) {
+	if ev, ok := event.(model.PositionChangedEvent); ok {
+		o.keyed.FireKeyed(key, ev)
+	}
+}
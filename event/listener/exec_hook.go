@@ -0,0 +1,131 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultExecHookTimeout = time.Minute
+
+type ExecHook struct {
+	Command        string   `json:"command"`
+	Args           []string `json:"args"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+func (h ExecHook) timeout() time.Duration {
+	if h.TimeoutSeconds <= 0 {
+		return defaultExecHookTimeout
+	}
+	return time.Duration(h.TimeoutSeconds) * time.Second
+}
+
+func (h ExecHook) String() string {
+	return strings.Join(append([]string{h.Command}, h.Args...), " ")
+}
+
+type ExecHooksConfig struct {
+	Hooks []ExecHook `json:"hooks"`
+	//MaxConcurrency limits hooks of an event running at the same time
+	MaxConcurrency int `json:"max_concurrency"`
+	//AdminUserId receives failures of hooks
+	AdminUserId string `json:"admin_user_id"`
+}
+
+//ExecHookListener runs local commands when the holder changes,
+//hooks of an event finish before hooks of the next one start, so a hook sees events in order of changes.
+//A redelivered event runs hooks again with the same QUEUE_EVENT_KEY, so a hook can tell it
+type ExecHookListener struct {
+	config    ExecHooksConfig
+	gateway   gateway.Gateway
+	localizer preference.Localizer
+	logger    *log.Logger
+	semaphore chan struct{}
+	clock     clock.Clock
+}
+
+func NewExecHookListener(lumberWriter io.Writer, config ExecHooksConfig, gateway gateway.Gateway, localizer preference.Localizer, clock clock.Clock) *ExecHookListener {
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = 1
+	}
+	return &ExecHookListener{
+		config:    config,
+		gateway:   gateway,
+		localizer: localizer,
+		logger:    log.New(lumberWriter, "exec-hook: ", log.Lshortfile|log.LstdFlags),
+		semaphore: make(chan struct{}, config.MaxConcurrency),
+		clock:     clock,
+	}
+}
+
+func (l *ExecHookListener) Fire(ev model.NewHolderEvent) {
+	l.FireKeyed("", ev)
+}
+
+func (l *ExecHookListener) FireKeyed(key string, ev model.NewHolderEvent) {
+	if isQueueEmptied(ev) {
+		return
+	}
+	stdin, err := json.Marshal(ev)
+	if err != nil {
+		l.logger.Printf("can't marshal %#v: %s", ev, err)
+		return
+	}
+	wg := sync.WaitGroup{}
+	for _, h := range l.config.Hooks {
+		l.semaphore <- struct{}{}
+		wg.Add(1)
+		go func(h ExecHook) {
+			defer wg.Done()
+			defer func() { <-l.semaphore }()
+			l.run(h, key, ev, stdin)
+		}(h)
+	}
+	wg.Wait()
+}
+
+//run tells the admin about a failure once per hook and event
+func (l *ExecHookListener) run(h ExecHook, key string, ev model.NewHolderEvent, stdin []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Env = append(os.Environ(),
+		"QUEUE_NEW_HOLDER="+ev.CurrentHolderUserId,
+		"QUEUE_PREV_HOLDER="+ev.PrevHolderUserId,
+		"QUEUE_AUTHOR="+ev.AuthorUserId,
+		"QUEUE_TS="+ev.Ts.Format(time.RFC3339),
+		"QUEUE_EVENT_KEY="+key,
+	)
+	cmd.Stdin = bytes.NewReader(stdin)
+	output := &bytes.Buffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	start := l.clock.Now()
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timeouted after %s", h.timeout())
+	}
+	l.logger.Printf("'%s' finished in %s with exit code %d, output:\n%s", h, l.clock.Now().Sub(start), cmd.ProcessState.ExitCode(), output)
+	if err != nil {
+		l.logger.Printf("'%s' failed: %s", h, err)
+		hookKey := ""
+		if key != "" {
+			hookKey = key + "/" + h.String()
+		}
+		gateway.WithKey(l.gateway, hookKey).SendAndLog(l.config.AdminUserId, l.localizer.Labels(l.config.AdminUserId).Format("exec_hook_failed", i18n.Params{"hook": h, "error": err}))
+	}
+}
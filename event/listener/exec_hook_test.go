@@ -0,0 +1,116 @@
+package listener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingGateway struct {
+	mu       sync.Mutex
+	inbox    map[string][]string
+	absences map[string]string
+}
+
+func (g *recordingGateway) Send(userId, txt string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.inbox == nil {
+		g.inbox = map[string][]string{}
+	}
+	g.inbox[userId] = append(g.inbox[userId], txt)
+	return nil
+}
+
+func (g *recordingGateway) SendAndLog(userId, txt string) {
+	_ = g.Send(userId, txt)
+}
+
+func (g *recordingGateway) SendMarkup(userId, markup string) error {
+	return g.Send(userId, markup)
+}
+
+func (g *recordingGateway) Notify(userId string, kind gateway.Kind, markup string) {
+	_ = g.Send(userId, markup)
+}
+
+func (g *recordingGateway) Mention(channel string, userId string, kind gateway.Kind, markup string) {
+	_ = g.Send(channel, gateway.MentionMarkup(userId, markup))
+}
+
+func (g *recordingGateway) Absence(userId string) (string, error) {
+	return g.absences[userId], nil
+}
+
+func (g *recordingGateway) received(userId string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.inbox[userId]
+}
+
+func TestExecHookListener_passes_context(t *testing.T) {
+	i18n.TestInit()
+	dir, err := ioutil.TempDir("", "exec-hook")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	gw := &recordingGateway{}
+	l := NewExecHookListener(ioutil.Discard, ExecHooksConfig{
+		Hooks: []ExecHook{{Command: "sh", Args: []string{"-c", `echo "$QUEUE_NEW_HOLDER $QUEUE_PREV_HOLDER $QUEUE_AUTHOR $QUEUE_EVENT_KEY" > ` + out + `; cat >> ` + out}}},
+	}, gw, preference.NewLocalizerMock(), clock.New())
+
+	l.FireKeyed("7", model.NewHolderEvent{CurrentHolderUserId: "2", PrevHolderUserId: "1", AuthorUserId: "3"})
+
+	assert.Eventually(t, func() bool {
+		bytes, _ := ioutil.ReadFile(out)
+		return string(bytes) == "2 1 3 7\n"+`{"current_holder_user_id":"2","prev_holder_user_id":"1","author_user_id":"3","ts":"0001-01-01T00:00:00Z"}`
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestExecHookListener_reports_failures(t *testing.T) {
+	i18n.TestInit()
+	gw := &recordingGateway{}
+	l := NewExecHookListener(ioutil.Discard, ExecHooksConfig{
+		Hooks: []ExecHook{
+			{Command: "sh", Args: []string{"-c", "exit 3"}},
+			{Command: "sleep", Args: []string{"5"}, TimeoutSeconds: 1},
+		},
+		AdminUserId:    "admin",
+		MaxConcurrency: 2,
+	}, gw, preference.NewLocalizerMock(), clock.New())
+
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "2"})
+
+	assert.Eventually(t, func() bool { return len(gw.received("admin")) == 2 }, time.Second*3, time.Millisecond*10)
+}
+
+func TestExecHookListener_keeps_order(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec-hook")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	l := NewExecHookListener(ioutil.Discard, ExecHooksConfig{
+		Hooks: []ExecHook{
+			{Command: "sh", Args: []string{"-c", `[ "$QUEUE_NEW_HOLDER" = 1 ] && sleep 0.3; echo $QUEUE_NEW_HOLDER >> ` + out}},
+			{Command: "true"},
+		},
+		MaxConcurrency: 2,
+	}, &recordingGateway{}, preference.NewLocalizerMock(), clock.New())
+
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	l.Fire(model.NewHolderEvent{PrevHolderUserId: "2"})
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "2"})
+
+	bytes, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n2\n", string(bytes), "emptied queue doesn't run hooks")
+}
@@ -10,28 +10,49 @@ import (
 type NewHolderEventListener interface {
 	Fire(newHolderEvent model.NewHolderEvent)
 }
+
+//HoldTimeEstimateListener keeps the previous holder change in sampleRepository, so a restart doesn't lose a hold time
 type HoldTimeEstimateListener struct {
 	estimateRepository estimate.Repository
-	prevEv             *model.NewHolderEvent
+	sampleRepository   estimate.SampleRepository
+	minHoldTime        time.Duration
+	maxHoldTime        time.Duration
 }
 
-func NewHoldTimeEstimateListener(estimateRepository estimate.Repository) *HoldTimeEstimateListener {
-	return &HoldTimeEstimateListener{estimateRepository: estimateRepository}
+func NewHoldTimeEstimateListener(estimateRepository estimate.Repository, sampleRepository estimate.SampleRepository, minHoldTime, maxHoldTime time.Duration) *HoldTimeEstimateListener {
+	return &HoldTimeEstimateListener{estimateRepository: estimateRepository, sampleRepository: sampleRepository, minHoldTime: minHoldTime, maxHoldTime: maxHoldTime}
 }
 func (l *HoldTimeEstimateListener) Fire(ev model.NewHolderEvent) {
-	if l.prevEv != nil && ev.AuthorUserId == ev.PrevHolderUserId {
-		duration := ev.Ts.Sub(l.prevEv.Ts)
-		if isTimeSeemsLegit(duration) {
+	l.FireKeyed("", ev)
+}
+
+//FireKeyed ignores a redelivered event, the sample is saved before the estimate,
+//so a crash in between loses a hold time rather than counts it twice
+func (l *HoldTimeEstimateListener) FireKeyed(key string, ev model.NewHolderEvent) {
+	sample, err := l.sampleRepository.Read()
+	if err != nil {
+		log.Printf("can't read hold time sample: %s", err)
+	}
+	if key != "" && key == sample.Key {
+		log.Printf("%s is handled already", key)
+		return
+	}
+	if err := l.sampleRepository.Save(estimate.Sample{Holder: &ev, Key: key}); err != nil {
+		log.Printf("can't save hold time sample: %s", err)
+	}
+	prevEv := sample.Holder
+	if prevEv != nil && ev.AuthorUserId == ev.PrevHolderUserId {
+		duration := ev.Ts.Sub(prevEv.Ts)
+		if l.isTimeSeemsLegit(duration) {
 			log.Printf("hold time was %s", duration.String())
 			l.calcEstimate(duration)
 		} else {
 			log.Printf("hold time discarded %s", duration.String())
 		}
 	}
-	l.prevEv = &ev
 }
-func isTimeSeemsLegit(duration time.Duration) bool {
-	return duration.Minutes() >= 15 && duration.Hours() <= 2
+func (l *HoldTimeEstimateListener) isTimeSeemsLegit(duration time.Duration) bool {
+	return duration >= l.minHoldTime && duration <= l.maxHoldTime
 }
 
 func (l *HoldTimeEstimateListener) calcEstimate(duration time.Duration) {
@@ -0,0 +1,58 @@
+package listener
+
+import (
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"log"
+	"time"
+)
+
+const holderStatusEmoji = ":lock:"
+
+//HolderStatusListener shows in Slack status of the holder that they hold the queue
+type HolderStatusListener struct {
+	profileGateway gateway.ProfileGateway
+	queueName      string
+	//expiration clears the status if the bot misses the holder leaving the front
+	expiration time.Duration
+	clock      clock.Clock
+}
+
+func NewHolderStatusListener(profileGateway gateway.ProfileGateway, queueName string, expiration time.Duration, clock clock.Clock) *HolderStatusListener {
+	return &HolderStatusListener{profileGateway: profileGateway, queueName: queueName, expiration: expiration, clock: clock}
+}
+
+//FireKeyed handles a redelivered event as a new one, setting the same status again changes nothing
+func (l *HolderStatusListener) FireKeyed(key string, ev model.NewHolderEvent) {
+	l.Fire(ev)
+}
+
+func (l *HolderStatusListener) Fire(ev model.NewHolderEvent) {
+	txt := i18n.L.Format("holder_status_text", i18n.Params{"queue": l.queueName})
+	if ev.PrevHolderUserId != "" {
+		l.clear(ev.PrevHolderUserId, txt)
+	}
+	if ev.CurrentHolderUserId != "" {
+		err := l.profileGateway.SetStatus(ev.CurrentHolderUserId, txt, holderStatusEmoji, l.clock.Now().Add(l.expiration))
+		if err != nil {
+			log.Printf("can't set status of %s: %s", ev.CurrentHolderUserId, err)
+		}
+	}
+}
+
+//clear clears the status unless the user has changed it
+func (l *HolderStatusListener) clear(userId string, txt string) {
+	current, err := l.profileGateway.StatusText(userId)
+	if err != nil {
+		log.Printf("can't get status of %s: %s", userId, err)
+		return
+	}
+	if current != txt {
+		return
+	}
+	if err := l.profileGateway.SetStatus(userId, "", "", time.Time{}); err != nil {
+		log.Printf("can't clear status of %s: %s", userId, err)
+	}
+}
@@ -1,9 +1,18 @@
 package listener
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
 	"github.com/yonesko/slack-queue-bot/estimate"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
 	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/outbox"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	usermock "github.com/yonesko/slack-queue-bot/user/mock"
+	"io/ioutil"
 	"strconv"
 	"testing"
 	"time"
@@ -11,7 +20,7 @@ import (
 
 func TestHoldTimeEstimateListener_FirstInQueue(t *testing.T) {
 	rep := &estimate.RepositoryMock{}
-	listener := NewHoldTimeEstimateListener(rep)
+	listener := NewHoldTimeEstimateListener(rep, &estimate.SampleRepositoryMock{}, time.Minute*15, time.Hour*2)
 
 	listener.Fire(model.NewHolderEvent{
 		CurrentHolderUserId: "123",
@@ -33,7 +42,7 @@ func TestHoldTimeEstimateListener_FirstInQueue(t *testing.T) {
 
 func TestHoldTimeEstimateListener_TooLongTime(t *testing.T) {
 	rep := &estimate.RepositoryMock{}
-	listener := NewHoldTimeEstimateListener(rep)
+	listener := NewHoldTimeEstimateListener(rep, &estimate.SampleRepositoryMock{}, time.Minute*15, time.Hour*2)
 
 	listener.Fire(model.NewHolderEvent{
 		CurrentHolderUserId: "123",
@@ -55,7 +64,7 @@ func TestHoldTimeEstimateListener_TooLongTime(t *testing.T) {
 
 func TestHoldTimeEstimateListener_InMiddleOfQueue(t *testing.T) {
 	rep := &estimate.RepositoryMock{}
-	listener := NewHoldTimeEstimateListener(rep)
+	listener := NewHoldTimeEstimateListener(rep, &estimate.SampleRepositoryMock{}, time.Minute*15, time.Hour*2)
 
 	listener.Fire(model.NewHolderEvent{
 		CurrentHolderUserId: "1",
@@ -77,7 +86,7 @@ func TestHoldTimeEstimateListener_InMiddleOfQueue(t *testing.T) {
 
 func TestHoldTimeEstimateListener_ForceDel(t *testing.T) {
 	rep := &estimate.RepositoryMock{}
-	listener := NewHoldTimeEstimateListener(rep)
+	listener := NewHoldTimeEstimateListener(rep, &estimate.SampleRepositoryMock{}, time.Minute*15, time.Hour*2)
 
 	listener.Fire(model.NewHolderEvent{
 		CurrentHolderUserId: "1",
@@ -99,7 +108,7 @@ func TestHoldTimeEstimateListener_ForceDel(t *testing.T) {
 
 func TestHoldTimeEstimateListener_MultiplyEvents(t *testing.T) {
 	rep := &estimate.RepositoryMock{}
-	listener := NewHoldTimeEstimateListener(rep)
+	listener := NewHoldTimeEstimateListener(rep, &estimate.SampleRepositoryMock{}, time.Minute*15, time.Hour*2)
 
 	for i := 1; i <= 100; i++ {
 		listener.Fire(model.NewHolderEvent{
@@ -114,3 +123,179 @@ func TestHoldTimeEstimateListener_MultiplyEvents(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, estimate.Estimate{time.Minute * 35, 99}, duration)
 }
+
+func TestHoldTimeEstimateListener_survives_restart(t *testing.T) {
+	rep := &estimate.RepositoryMock{}
+	samples := &estimate.SampleRepositoryMock{}
+	NewHoldTimeEstimateListener(rep, samples, time.Minute*15, time.Hour*2).FireKeyed("event-1", model.NewHolderEvent{
+		CurrentHolderUserId: "1",
+		AuthorUserId:        "1",
+		Ts:                  time.Unix(0, 0),
+	})
+
+	listener := NewHoldTimeEstimateListener(rep, samples, time.Minute*15, time.Hour*2)
+	second := model.NewHolderEvent{
+		CurrentHolderUserId: "2",
+		PrevHolderUserId:    "1",
+		AuthorUserId:        "1",
+		Ts:                  time.Unix(int64((time.Minute * 35).Seconds()), 0),
+	}
+	listener.FireKeyed("event-2", second)
+	listener.FireKeyed("event-2", second)
+	duration, err := rep.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, estimate.Estimate{time.Minute * 35, 1}, duration, "a redelivered event isn't counted twice")
+}
+
+func TestHolderStatusListener(t *testing.T) {
+	i18n.InitFrom("../../i18n", "english")
+	profile := &gateway.ProfileMock{}
+	fake := clock.NewFake(time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC))
+	l := NewHolderStatusListener(profile, "staging", time.Hour, fake)
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	status := profile.Statuses["1"]
+	assert.Equal(t, "holding staging", status.Text)
+	assert.Equal(t, ":lock:", status.Emoji)
+	assert.Equal(t, fake.Now().Add(time.Hour), status.Expiration)
+
+	fake.Advance(time.Minute)
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "2", PrevHolderUserId: "1"})
+	assert.Equal(t, gateway.Status{}, profile.Statuses["1"], "status of the previous holder is cleared")
+	assert.Equal(t, "holding staging", profile.Statuses["2"].Text)
+	assert.Equal(t, fake.Now().Add(time.Hour), profile.Statuses["2"].Expiration)
+
+	assert.Nil(t, profile.SetStatus("2", "in a meeting", ":calendar:", time.Time{}))
+	l.Fire(model.NewHolderEvent{PrevHolderUserId: "2"})
+	assert.Equal(t, "in a meeting", profile.Statuses["2"].Text, "status changed by the holder is kept")
+}
+
+func TestNotifyNewSecondEventListener_absent_second(t *testing.T) {
+	i18n.TestInit()
+	gw := &recordingGateway{absences: map[string]string{"1": gateway.AbsenceDnd}}
+
+	NewNotifyNewSecondEventListener(gw, preference.NewLocalizerMock(), usecase.NotifyAbsent).Fire(model.NewSecondEvent{CurrentSecondUserId: "1"})
+	assert.Len(t, gw.received("1"), 1, "notify policy warns regardless of presence")
+
+	NewNotifyNewSecondEventListener(gw, preference.NewLocalizerMock(), usecase.SkipAbsent).Fire(model.NewSecondEvent{CurrentSecondUserId: "1"})
+	assert.Len(t, gw.received("1"), 1, "absent second isn't warned")
+
+	NewNotifyNewSecondEventListener(gw, preference.NewLocalizerMock(), usecase.WaitForAbsent).Fire(model.NewSecondEvent{CurrentSecondUserId: "2"})
+	assert.Len(t, gw.received("2"), 1, "present second is warned")
+}
+
+func TestNotifyWatchersListener_queue_empty(t *testing.T) {
+	i18n.InitFrom("../../i18n", "english")
+	preferences := &preference.RepositoryMock{}
+	assert.Nil(t, preferences.Save(preference.Preferences{}.
+		With("1", preference.UserPreferences{}.WithDelivery(preference.TopicEmpty, preference.DeliveryDm)).
+		With("2", preference.UserPreferences{Language: "english"}).
+		With("3", preference.UserPreferences{Watch: preference.WatchEmpty}.WithDelivery(preference.TopicEmpty, preference.DeliveryDm))))
+	gw := &recordingGateway{}
+	l := NewNotifyWatchersListener(gw, preferences, usermock.NewUserRepository(nil), preference.NewLocalizerMock(), "stage")
+
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "3", PrevHolderUserId: "4"})
+	assert.Empty(t, gw.received("1"))
+
+	l.Fire(model.NewHolderEvent{PrevHolderUserId: "3"})
+	assert.Equal(t, []string{"Queue is empty now, come on in"}, gw.received("1"))
+	assert.Empty(t, gw.received("2"), "empty queue notifications are off by default")
+	assert.Equal(t, []string{"stage is free now"}, gw.received("3"), "a watcher is told once")
+}
+
+func TestNotifyWatchersListener(t *testing.T) {
+	i18n.InitFrom("../../i18n", "english")
+	preferences := &preference.RepositoryMock{}
+	assert.Nil(t, preferences.Save(preference.Preferences{}.
+		With("1", preference.UserPreferences{Watch: preference.WatchEmpty}).
+		With("2", preference.UserPreferences{Watch: preference.WatchHolder}).
+		With("3", preference.UserPreferences{Watch: preference.WatchBoth}).
+		With("4", preference.UserPreferences{})))
+	users := usermock.NewUserRepository(map[string]model.User{"4": {FullName: "Bob"}, "6": {FullName: "<@U1> & co"}})
+	gw := &recordingGateway{}
+	l := NewNotifyWatchersListener(gw, preferences, users, preference.NewLocalizerMock(), "stage")
+
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "4", PrevHolderUserId: "5"})
+	assert.Empty(t, gw.received("1"))
+	assert.Equal(t, []string{"Bob holds stage now"}, gw.received("2"))
+	assert.Equal(t, []string{"Bob holds stage now"}, gw.received("3"))
+	assert.Empty(t, gw.received("4"), "the holder isn't told about themselves")
+
+	l.Fire(model.NewHolderEvent{PrevHolderUserId: "4"})
+	assert.Equal(t, []string{"stage is free now"}, gw.received("1"))
+	assert.Len(t, gw.received("2"), 1)
+	assert.Equal(t, []string{"Bob holds stage now", "stage is free now"}, gw.received("3"))
+	assert.Empty(t, gw.received("4"))
+
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "6"})
+	assert.Equal(t, "&lt;@U1&gt; &amp; co holds stage now", gw.received("2")[1], "names are plain text in notification markup")
+}
+
+func TestNotifyPositionListener(t *testing.T) {
+	i18n.InitFrom("../../i18n", "english")
+	preferences := &preference.RepositoryMock{}
+	assert.Nil(t, preferences.Save(preference.Preferences{}.
+		With("1", preference.UserPreferences{AlertPosition: 2}).
+		With("2", preference.UserPreferences{AlertJumps: true}).
+		With("3", preference.UserPreferences{AlertJumps: true})))
+	estimates := &estimate.RepositoryMock{}
+	assert.Nil(t, estimates.Save(estimate.Estimate{Average: time.Minute * 30, Estimations: 1}))
+	users := usermock.NewUserRepository(map[string]model.User{"4": {FullName: "Bob"}})
+	gw := &recordingGateway{}
+	fake := clock.NewFake(time.Date(2020, 3, 2, 10, 0, 0, 0, time.Local))
+	l := NewNotifyPositionListener(gw, preferences, users, estimates, preference.NewLocalizerMock(), preference.NewFormatter(preference.NewLocalizerMock(), users), fake)
+
+	//4 and 1 jump ahead of 2 and 3
+	l.Fire(model.PositionChangedEvent{AuthorUserId: "5", HoldTs: fake.Now(), Changes: []model.PositionChange{
+		{UserId: "5", OldIndex: 0, NewIndex: 0},
+		{UserId: "4", OldIndex: 3, NewIndex: 1},
+		{UserId: "1", OldIndex: 4, NewIndex: 2},
+		{UserId: "2", OldIndex: 1, NewIndex: 3},
+		{UserId: "3", OldIndex: 2, NewIndex: 4},
+	}})
+	assert.Empty(t, gw.received("1"), "1 wants to know about the 2nd position only")
+	assert.Len(t, gw.received("2"), 1)
+	eta := fake.Now().Add(time.Minute * 90)
+	assert.Equal(t, fmt.Sprintf("Bob jumped ahead of you, you are `4º` now, your turn in ~1 hour 30 minutes (<!date^%d^{date_short_pretty} {time}|Mon Mar 2 11:30>)", eta.Unix()), gw.received("2")[0])
+	assert.Len(t, gw.received("3"), 1)
+
+	fake.Advance(time.Minute * 10)
+	l.Fire(model.PositionChangedEvent{AuthorUserId: "5", HoldTs: fake.Now().Add(-time.Minute * 10), Changes: []model.PositionChange{
+		{UserId: "1", OldIndex: 2, NewIndex: 1},
+	}})
+	assert.Len(t, gw.received("1"), 1)
+	assert.Equal(t, fmt.Sprintf("You are `2º` in the queue, your turn in ~20 minutes (<!date^%d^{date_short_pretty} {time}|Mon Mar 2 10:30>)", fake.Now().Add(time.Minute*20).Unix()), gw.received("1")[0], "the ETA counts from the hold time")
+}
+
+func TestNotifyListeners_redelivered_event(t *testing.T) {
+	i18n.InitFrom("../../i18n", "english")
+	preferences := &preference.RepositoryMock{}
+	assert.Nil(t, preferences.Save(preference.Preferences{}.
+		With("1", preference.UserPreferences{Watch: preference.WatchHolder}).
+		With("2", preference.UserPreferences{AlertPosition: 1}.WithDelivery(preference.TopicPosition, preference.DeliveryDm))))
+	users := usermock.NewUserRepository(nil)
+	repository := &outbox.RepositoryMock{}
+	gw := preference.NewNotificationGateway(gateway.NewOutboxGateway(ioutil.Discard, &recordingGateway{}, repository, 0, clock.New()), preferences, "")
+	fake := clock.NewFake(time.Date(2020, 3, 2, 10, 0, 0, 0, time.Local))
+	listeners := []EventListener{
+		OnNewSecond(NewNotifyNewSecondEventListener(gw, preference.NewLocalizerMock(), usecase.NotifyAbsent)),
+		OnDeleted(NewNotifyDeletedEventListener(gw, users, preference.NewLocalizerMock())),
+		OnNewHolder(NewNotifyWatchersListener(gw, preferences, users, preference.NewLocalizerMock(), "stage")),
+		OnPositionChanged(NewNotifyPositionListener(gw, preferences, users, &estimate.RepositoryMock{}, preference.NewLocalizerMock(), preference.NewFormatter(preference.NewLocalizerMock(), users), fake)),
+	}
+	events := []interface{}{
+		model.NewSecondEvent{CurrentSecondUserId: "3"},
+		model.DeletedEvent{DeletedUserId: "4"},
+		model.NewHolderEvent{CurrentHolderUserId: "2"},
+		model.PositionChangedEvent{Changes: []model.PositionChange{{UserId: "2", OldIndex: 1, NewIndex: 0}}},
+	}
+	for i, l := range listeners {
+		keyed, ok := l.(KeyedEventListener)
+		assert.True(t, ok, "the bus replays events to notification listeners")
+		keyed.FireKeyed(strconv.Itoa(i), events[i])
+		keyed.FireKeyed(strconv.Itoa(i), events[i])
+	}
+	assert.Len(t, repository.Outbox.Pending, 4, "notifications about a redelivered event are dropped")
+
+	listeners[1].(KeyedEventListener).FireKeyed("next", events[1])
+	assert.Len(t, repository.Outbox.Pending, 5, "the same change by another event is notified")
+}
@@ -2,7 +2,9 @@ package listener
 
 import (
 	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
 	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
 	"github.com/yonesko/slack-queue-bot/user"
 )
 
@@ -13,20 +15,19 @@ type DeletedEventListener interface {
 type notifyDeletedEventListener struct {
 	gateway        gateway.Gateway
 	userRepository user.Repository
+	localizer      preference.Localizer
 }
 
-func NewNotifyDeletedEventListener(gateway gateway.Gateway, userRepository user.Repository) *notifyDeletedEventListener {
-	return &notifyDeletedEventListener{gateway: gateway, userRepository: userRepository}
+func NewNotifyDeletedEventListener(gateway gateway.Gateway, userRepository user.Repository, localizer preference.Localizer) *notifyDeletedEventListener {
+	return &notifyDeletedEventListener{gateway: gateway, userRepository: userRepository, localizer: localizer}
 }
 
 func (n *notifyDeletedEventListener) Fire(ev model.DeletedEvent) {
-	n.gateway.SendAndLog(ev.DeletedUserId, n.deleterTxt(ev.AuthorUserId)+" выкинул тебя из маршрутки")
+	n.FireKeyed("", ev)
 }
 
-func (n *notifyDeletedEventListener) deleterTxt(userId string) string {
-	user, err := n.userRepository.FindById(userId)
-	if err != nil {
-		return "кто-то"
-	}
-	return user.FullName
+//FireKeyed tells the deleted user who deleted them, the outbox drops the notification about a redelivered event
+func (n *notifyDeletedEventListener) FireKeyed(key string, ev model.DeletedEvent) {
+	labels := n.localizer.Labels(ev.DeletedUserId)
+	gateway.WithKey(n.gateway, key).Notify(ev.DeletedUserId, gateway.KindDeleted, labels.Format("you_are_deleted", i18n.Params{"deleter": userTxt(n.userRepository, ev.AuthorUserId, labels)}))
 }
@@ -0,0 +1,105 @@
+package listener
+
+import (
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/estimate"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"github.com/yonesko/slack-queue-bot/user"
+	"log"
+	"time"
+)
+
+type PositionChangedEventListener interface {
+	Fire(ev model.PositionChangedEvent)
+}
+
+//NotifyPositionListener alerts users reaching the position they have chosen with the alert command
+//and users someone has jumped ahead of
+type NotifyPositionListener struct {
+	gateway              gateway.Gateway
+	preferenceRepository preference.Repository
+	userRepository       user.Repository
+	estimateRepository   estimate.Repository
+	localizer            preference.Localizer
+	formatter            preference.Formatter
+	clock                clock.Clock
+}
+
+func NewNotifyPositionListener(gateway gateway.Gateway, preferenceRepository preference.Repository, userRepository user.Repository, estimateRepository estimate.Repository, localizer preference.Localizer, formatter preference.Formatter, clock clock.Clock) *NotifyPositionListener {
+	return &NotifyPositionListener{
+		gateway:              gateway,
+		preferenceRepository: preferenceRepository,
+		userRepository:       userRepository,
+		estimateRepository:   estimateRepository,
+		localizer:            localizer,
+		formatter:            formatter,
+		clock:                clock,
+	}
+}
+
+func (n *NotifyPositionListener) Fire(ev model.PositionChangedEvent) {
+	n.FireKeyed("", ev)
+}
+
+//FireKeyed alerts the users, the outbox drops alerts about a redelivered event
+func (n *NotifyPositionListener) FireKeyed(key string, ev model.PositionChangedEvent) {
+	notifier := gateway.WithKey(n.gateway, key)
+	preferences, err := n.preferenceRepository.Read()
+	if err != nil {
+		log.Printf("can't alert positions: %s", err)
+		return
+	}
+	for _, change := range ev.Changes {
+		if change.NewIndex < 0 || !change.Changed() {
+			continue
+		}
+		userPreferences := preferences.Of(change.UserId)
+		labels := n.localizer.Labels(change.UserId)
+		params := i18n.Params{"position": change.NewIndex + 1, "eta": n.etaTxt(change.UserId, change.NewIndex, ev.HoldTs, labels)}
+		if jumper, ok := jumpedAhead(change, ev); ok && userPreferences.AlertJumps && change.UserId != ev.AuthorUserId {
+			params["user"] = userTxt(n.userRepository, jumper, labels)
+			notifier.Notify(change.UserId, gateway.KindPosition, labels.Format("someone_jumped_ahead", params))
+			continue
+		}
+		if userPreferences.AlertPosition == change.NewIndex+1 {
+			notifier.Notify(change.UserId, gateway.KindPosition, labels.Format("position_alert", params))
+		}
+	}
+}
+
+//jumpedAhead finds someone who was behind the user or out of the queue and is ahead of them now
+func jumpedAhead(change model.PositionChange, ev model.PositionChangedEvent) (string, bool) {
+	if change.OldIndex < 0 {
+		return "", false
+	}
+	for _, other := range ev.Changes {
+		if other.NewIndex >= 0 && other.NewIndex < change.NewIndex && (other.OldIndex < 0 || other.OldIndex > change.OldIndex) {
+			return other.UserId, true
+		}
+	}
+	return "", false
+}
+
+func (n *NotifyPositionListener) etaTxt(userId string, index int, holdTs time.Time, labels i18n.Labels) string {
+	if index == 0 {
+		return ""
+	}
+	estimate, err := n.estimateRepository.Read()
+	if err != nil {
+		log.Printf("can't get estimate %s", err)
+		return ""
+	}
+	now := n.clock.Now()
+	duration := estimate.TimeToWait(uint(index), holdTs, now).Round(time.Minute)
+	if duration <= 0 {
+		return ""
+	}
+	//the time is date markup, Slack shows it in the timezone of the user
+	return labels.Format("position_eta", i18n.Params{
+		"duration": n.formatter.Duration(userId, duration),
+		"time":     n.formatter.Time(userId, now.Add(duration)),
+	})
+}
@@ -2,8 +2,10 @@ package listener
 
 import (
 	"github.com/yonesko/slack-queue-bot/gateway"
-	"github.com/yonesko/slack-queue-bot/i18n"
 	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"log"
 )
 
 type NewSecondEventListener interface {
@@ -11,13 +13,31 @@ type NewSecondEventListener interface {
 }
 
 type NotifyNewSecondEventListener struct {
-	gateway gateway.Gateway
+	gateway        gateway.Gateway
+	localizer      preference.Localizer
+	presencePolicy usecase.PresencePolicy
 }
 
-func NewNotifyNewSecondEventListener(gateway gateway.Gateway) *NotifyNewSecondEventListener {
-	return &NotifyNewSecondEventListener{gateway: gateway}
+func NewNotifyNewSecondEventListener(gateway gateway.Gateway, localizer preference.Localizer, presencePolicy usecase.PresencePolicy) *NotifyNewSecondEventListener {
+	return &NotifyNewSecondEventListener{gateway: gateway, localizer: localizer, presencePolicy: presencePolicy}
 }
 
 func (n *NotifyNewSecondEventListener) Fire(ev model.NewSecondEvent) {
-	n.gateway.SendAndLog(ev.CurrentSecondUserId, i18n.L.MustGet("you_are_the_second"))
+	n.FireKeyed("", ev)
+}
+
+//FireKeyed warns the second one, unless they are absent and the presence policy isn't to notify regardless,
+//the outbox drops the warning about a redelivered event
+func (n *NotifyNewSecondEventListener) FireKeyed(key string, ev model.NewSecondEvent) {
+	if n.presencePolicy != "" && n.presencePolicy != usecase.NotifyAbsent {
+		absence, err := n.gateway.Absence(ev.CurrentSecondUserId)
+		if err != nil {
+			log.Printf("can't get absence of %s, consider present: %s", ev.CurrentSecondUserId, err)
+		}
+		if absence != "" {
+			log.Printf("don't warn the second %s, they are %s", ev.CurrentSecondUserId, absence)
+			return
+		}
+	}
+	gateway.WithKey(n.gateway, key).Notify(ev.CurrentSecondUserId, gateway.KindYouAreSecond, n.localizer.Labels(ev.CurrentSecondUserId).MustGet("you_are_the_second"))
 }
@@ -0,0 +1,71 @@
+package listener
+
+import (
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"github.com/yonesko/slack-queue-bot/user"
+	"log"
+)
+
+//NotifyWatchersListener tells users watching the queue that it is empty or who holds it now,
+//and users who have turned empty queue notifications on that the queue is free.
+//A user is told once that the queue is empty, as a watcher if they watch it
+type NotifyWatchersListener struct {
+	gateway              gateway.Gateway
+	preferenceRepository preference.Repository
+	userRepository       user.Repository
+	localizer            preference.Localizer
+	queueName            string
+}
+
+func NewNotifyWatchersListener(gateway gateway.Gateway, preferenceRepository preference.Repository, userRepository user.Repository, localizer preference.Localizer, queueName string) *NotifyWatchersListener {
+	return &NotifyWatchersListener{
+		gateway:              gateway,
+		preferenceRepository: preferenceRepository,
+		userRepository:       userRepository,
+		localizer:            localizer,
+		queueName:            queueName,
+	}
+}
+
+func (n *NotifyWatchersListener) Fire(ev model.NewHolderEvent) {
+	n.FireKeyed("", ev)
+}
+
+//FireKeyed notifies the users, the outbox drops notifications about a redelivered event
+func (n *NotifyWatchersListener) FireKeyed(key string, ev model.NewHolderEvent) {
+	emptied := ev.CurrentHolderUserId == "" && ev.PrevHolderUserId != ""
+	if ev.CurrentHolderUserId == "" && !emptied {
+		return
+	}
+	preferences, err := n.preferenceRepository.Read()
+	if err != nil {
+		log.Printf("can't notify watchers: %s", err)
+		return
+	}
+	notifier := gateway.WithKey(n.gateway, key)
+	for userId, userPreferences := range preferences.Users {
+		labels := n.localizer.Labels(userId)
+		switch {
+		case emptied && userPreferences.Watch.Empty():
+			notifier.Notify(userId, gateway.KindWatch, labels.Format("watch_queue_empty", i18n.Params{"queue": n.queueName}))
+		case emptied && userPreferences.Delivery(preference.TopicEmpty) != preference.DeliveryOff:
+			notifier.Notify(userId, gateway.KindQueueEmpty, labels.MustGet("queue_is_empty_now"))
+		case !emptied && userPreferences.Watch.Holder() && userId != ev.CurrentHolderUserId:
+			notifier.Notify(userId, gateway.KindWatch, labels.Format("watch_new_holder", i18n.Params{
+				"queue": n.queueName,
+				"user":  userTxt(n.userRepository, ev.CurrentHolderUserId, labels),
+			}))
+		}
+	}
+}
+
+//userTxt is the full name of the user escaped for notification markup, or "someone" if the user isn't found
+func userTxt(userRepository user.Repository, userId string, labels i18n.Labels) string {
+	if user, err := userRepository.FindById(userId); err == nil {
+		return gateway.Escape(user.FullName)
+	}
+	return labels.MustGet("someone")
+}
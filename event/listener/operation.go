@@ -0,0 +1,124 @@
+package listener
+
+import "github.com/yonesko/slack-queue-bot/model"
+
+//listeners of operations on the queue, adapt them to the bus with On<Operation>
+
+type AddedEventListener interface {
+	Fire(ev model.AddedEvent)
+}
+
+type PassedEventListener interface {
+	Fire(ev model.PassedEvent)
+}
+
+type AckedEventListener interface {
+	Fire(ev model.AckedEvent)
+}
+
+type CleanedEventListener interface {
+	Fire(ev model.CleanedEvent)
+}
+
+type HolderTimedOutEventListener interface {
+	Fire(ev model.HolderTimedOutEvent)
+}
+
+type PoppedEventListener interface {
+	Fire(ev model.PoppedEvent)
+}
+
+type ReleasedEventListener interface {
+	Fire(ev model.ReleasedEvent)
+}
+
+//OnAdded adapts l to the bus, other events are ignored
+func OnAdded(l AddedEventListener) EventListener {
+	return onAdded{l}
+}
+
+type onAdded struct{ l AddedEventListener }
+
+func (o onAdded) Fire(event interface{}) {
+	if ev, ok := event.(model.AddedEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+//OnPassed adapts l to the bus, other events are ignored
+func OnPassed(l PassedEventListener) EventListener {
+	return onPassed{l}
+}
+
+type onPassed struct{ l PassedEventListener }
+
+func (o onPassed) Fire(event interface{}) {
+	if ev, ok := event.(model.PassedEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+//OnAcked adapts l to the bus, other events are ignored
+func OnAcked(l AckedEventListener) EventListener {
+	return onAcked{l}
+}
+
+type onAcked struct{ l AckedEventListener }
+
+func (o onAcked) Fire(event interface{}) {
+	if ev, ok := event.(model.AckedEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+//OnCleaned adapts l to the bus, other events are ignored
+func OnCleaned(l CleanedEventListener) EventListener {
+	return onCleaned{l}
+}
+
+type onCleaned struct{ l CleanedEventListener }
+
+func (o onCleaned) Fire(event interface{}) {
+	if ev, ok := event.(model.CleanedEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+//OnHolderTimedOut adapts l to the bus, other events are ignored
+func OnHolderTimedOut(l HolderTimedOutEventListener) EventListener {
+	return onHolderTimedOut{l}
+}
+
+type onHolderTimedOut struct{ l HolderTimedOutEventListener }
+
+func (o onHolderTimedOut) Fire(event interface{}) {
+	if ev, ok := event.(model.HolderTimedOutEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+//OnPopped adapts l to the bus, other events are ignored
+func OnPopped(l PoppedEventListener) EventListener {
+	return onPopped{l}
+}
+
+type onPopped struct{ l PoppedEventListener }
+
+func (o onPopped) Fire(event interface{}) {
+	if ev, ok := event.(model.PoppedEvent); ok {
+		o.l.Fire(ev)
+	}
+}
+
+//OnReleased adapts l to the bus, other events are ignored
+func OnReleased(l ReleasedEventListener) EventListener {
+	return onReleased{l}
+}
+
+type onReleased struct{ l ReleasedEventListener }
+
+func (o onReleased) Fire(event interface{}) {
+	if ev, ok := event.(model.ReleasedEvent); ok {
+		o.l.Fire(ev)
+	}
+}
@@ -0,0 +1,144 @@
+package listener
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/model"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+const (
+	webhookAttempts       = 5
+	webhookInitialBackoff = time.Second
+	signatureHeader       = "X-Queue-Bot-Signature"
+)
+
+//Webhook is an URL to POST events to
+type Webhook struct {
+	Url string `json:"url"`
+	//Secret signs the body with HMAC-SHA256 if not empty
+	Secret string `json:"secret"`
+	//Events are names of event types to send, e.g. NewHolderEvent, all events are sent if empty
+	Events []string `json:"events"`
+}
+
+func (w Webhook) accepts(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type webhookPayload struct {
+	//Id is the same for a redelivered event, so receivers can drop duplicates
+	Id    string      `json:"id,omitempty"`
+	Type  string      `json:"type"`
+	Ts    time.Time   `json:"ts"`
+	Event interface{} `json:"event"`
+}
+
+type WebhookListener struct {
+	webhooks []Webhook
+	client   *http.Client
+	logger   *log.Logger
+	clock    clock.Clock
+}
+
+func NewWebhookListener(lumberWriter io.Writer, webhooks []Webhook, clock clock.Clock) *WebhookListener {
+	return &WebhookListener{
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: time.Second * 10},
+		logger:   log.New(lumberWriter, "webhook: ", log.Lshortfile|log.LstdFlags),
+		clock:    clock,
+	}
+}
+
+func (l *WebhookListener) Fire(event interface{}) {
+	l.FireKeyed("", event)
+}
+
+//FireKeyed delivers the event to the webhooks one by one and returns when they are done,
+//so the bus doesn't check it off before delivery and webhooks get events in order
+func (l *WebhookListener) FireKeyed(key string, event interface{}) {
+	if isQueueEmptied(event) {
+		return
+	}
+	eventType := reflect.TypeOf(event).Name()
+	body, err := json.Marshal(webhookPayload{Id: key, Type: eventType, Ts: l.clock.Now(), Event: event})
+	if err != nil {
+		l.logger.Printf("can't marshal %#v: %s", event, err)
+		return
+	}
+	for _, w := range l.webhooks {
+		if w.accepts(eventType) {
+			l.deliver(w, body)
+		}
+	}
+}
+
+func (l *WebhookListener) deliver(w Webhook, body []byte) {
+	backoff := webhookInitialBackoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := l.post(w, body)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt == webhookAttempts {
+			l.logger.Printf("can't deliver to %s after %d attempts, dropped: %s", w.Url, attempt, err)
+			return
+		}
+		l.logger.Printf("can't deliver to %s, retry in %s: %s", w.Url, backoff, err)
+		clock.Sleep(l.clock, backoff)
+		backoff *= 2
+	}
+}
+
+func (l *WebhookListener) post(w Webhook, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+sign(w.Secret, body))
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//isQueueEmptied tells if event is NewHolderEvent without a holder, it's used by the bot itself,
+//hooks get NewHolderEvent with a holder only and learn of the emptied queue from operation events
+func isQueueEmptied(event interface{}) bool {
+	ev, ok := event.(model.NewHolderEvent)
+	return ok && ev.CurrentHolderUserId == ""
+}
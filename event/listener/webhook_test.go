@@ -0,0 +1,92 @@
+package listener
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookListener_signs_and_filters(t *testing.T) {
+	received := make(chan map[string]interface{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		payload := map[string]interface{}{}
+		_ = json.Unmarshal(body, &payload)
+		assert.Equal(t, "sha256="+sign("secret", body), r.Header.Get(signatureHeader))
+		received <- payload
+	}))
+	defer server.Close()
+	fake := clock.NewFake(time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC))
+	l := NewWebhookListener(ioutil.Discard, []Webhook{{Url: server.URL, Secret: "secret", Events: []string{"DeletedEvent"}}}, fake)
+
+	l.Fire(model.NewSecondEvent{CurrentSecondUserId: "1"})
+	l.webhooks[0].Events = append(l.webhooks[0].Events, "NewHolderEvent")
+	l.Fire(model.NewHolderEvent{PrevHolderUserId: "1"})
+	l.FireKeyed("event-7", model.DeletedEvent{AuthorUserId: "1", DeletedUserId: "2"})
+
+	assert.Len(t, received, 1, "filtered events aren't delivered")
+	payload := <-received
+	assert.Equal(t, "DeletedEvent", payload["type"])
+	assert.Equal(t, "event-7", payload["id"])
+	assert.Equal(t, "2020-03-02T11:30:00Z", payload["ts"])
+	assert.Equal(t, map[string]interface{}{"author_user_id": "1", "deleted_user_id": "2"}, payload["event"])
+}
+
+func TestWebhookListener_retries(t *testing.T) {
+	mu := sync.Mutex{}
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	callsSoFar := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+	fake := clock.NewFake(time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC))
+	l := NewWebhookListener(ioutil.Discard, []Webhook{{Url: server.URL}}, fake)
+
+	done := make(chan struct{})
+	go func() {
+		l.Fire(model.NewHolderEvent{CurrentHolderUserId: "1"})
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return fake.Timers() == 1 }, time.Second*5, time.Millisecond*10, "the retry waits")
+	assert.Equal(t, 1, callsSoFar())
+	fake.Advance(webhookInitialBackoff)
+	assert.Eventually(t, func() bool { return callsSoFar() == 2 && fake.Timers() == 1 }, time.Second*5, time.Millisecond*10)
+	fake.Advance(webhookInitialBackoff)
+	assert.Equal(t, 2, callsSoFar(), "the backoff doubles")
+	fake.Advance(webhookInitialBackoff)
+	<-done
+	assert.Equal(t, 3, callsSoFar(), "Fire returns when the event is delivered")
+}
+
+func TestWebhookListener_no_retry_on_client_error(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	fake := clock.NewFake(time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC))
+	l := NewWebhookListener(ioutil.Discard, []Webhook{{Url: server.URL}}, fake)
+
+	l.Fire(model.NewHolderEvent{CurrentHolderUserId: "1"})
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 0, fake.Timers())
+}
@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"github.com/yonesko/slack-queue-bot/outbox"
+	"log"
+	"strings"
+)
+
+//Kind of a notification tells which earlier notifications it supersedes
+type Kind string
+
+const (
+	KindYouAreSecond Kind = "you_are_second"
+	KindYourTurn     Kind = "your_turn"
+	KindPassed       Kind = "passed"
+	KindDeleted      Kind = "deleted"
+	KindQueueEmpty   Kind = "queue_empty"
+	KindPosition     Kind = "position"
+	KindWatch        Kind = "watch"
+)
+
+//supersedes are kinds made stale by a later notification of the kind, a kind always supersedes itself
+var supersedes = map[Kind][]Kind{
+	KindYourTurn: {KindYouAreSecond},
+	KindPassed:   {KindYourTurn},
+	KindDeleted:  {KindYouAreSecond, KindYourTurn},
+}
+
+//coalesce drops notifications to a user superseded by later notifications
+func coalesce(messages []outbox.Message, logger *log.Logger) []outbox.Message {
+	var actual []outbox.Message
+	for _, m := range messages {
+		actual = append(supersede(actual, m, logger), m)
+	}
+	return actual
+}
+
+//joinTexts makes one message of the notifications
+func joinTexts(messages []outbox.Message) string {
+	var lines []string
+	for _, m := range messages {
+		lines = append(lines, m.Text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+//supersede drops notifications made stale by the later one, plain messages and mentions of other users are never dropped
+func supersede(messages []outbox.Message, later outbox.Message, logger *log.Logger) []outbox.Message {
+	kind := Kind(later.Kind)
+	var actual []outbox.Message
+	for _, m := range messages {
+		if m.Kind != "" && m.About == later.About && (Kind(m.Kind) == kind || kindsContain(supersedes[kind], Kind(m.Kind))) {
+			logger.Printf("drop '%s', it is superseded by %s", m.Text, kind)
+			continue
+		}
+		actual = append(actual, m)
+	}
+	return actual
+}
+
+func kindsContain(kinds []Kind, kind Kind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/outbox"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestOutboxGateway_merges_and_drops_superseded(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	delegate := &flakyGateway{}
+	repository := &outbox.RepositoryMock{}
+	o := NewOutboxGateway(ioutil.Discard, delegate, repository, time.Second*3, fake)
+
+	o.Notify("1", KindYouAreSecond, "you are the second")
+	o.Notify("1", KindYourTurn, "your turn")
+	o.Notify("1", KindDeleted, "you are deleted")
+	o.Notify("2", KindYouAreSecond, "you are the second")
+	o.Notify("2", KindYouAreSecond, "you are the second")
+	o.Notify("3", KindYouAreSecond, "you are the second")
+	o.Notify("3", KindYourTurn, "your turn")
+	assert.Equal(t, time.Second*3, o.deliverDue())
+	assert.Empty(t, delegate.received())
+	assert.Len(t, repository.Outbox.Pending, 7, "notifications are persisted while they wait")
+
+	fake.Advance(time.Second * 3)
+	o.deliverDue()
+	assert.ElementsMatch(t, []string{
+		"1: you are deleted",
+		"2: you are the second",
+		"3: your turn",
+	}, delegate.received())
+	assert.Empty(t, repository.Outbox.Pending)
+}
+
+func TestOutboxGateway_window_starts_with_first_notification(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	delegate := &flakyGateway{}
+	o := NewOutboxGateway(ioutil.Discard, delegate, &outbox.RepositoryMock{}, time.Second*3, fake)
+
+	o.Notify("1", KindYouAreSecond, "you are the second")
+	fake.Advance(time.Second * 2)
+	o.Notify("1", KindPosition, "you are the third")
+	assert.Equal(t, time.Second, o.deliverDue())
+	fake.Advance(time.Second)
+	o.deliverDue()
+	assert.Equal(t, []string{"1: you are the second\nyou are the third"}, delegate.received())
+}
+
+func TestOutboxGateway_send_keeps_order(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	delegate := &flakyGateway{}
+	o := NewOutboxGateway(ioutil.Discard, delegate, &outbox.RepositoryMock{}, time.Hour, fake)
+
+	o.Notify("1", KindYouAreSecond, "you are the second")
+	o.Notify("1", KindWatch, "queue is free")
+	assert.Nil(t, o.Send("1", "pipeline finished"))
+	o.deliverDue()
+	o.deliverDue()
+	assert.Equal(t, []string{"1: you are the second\nqueue is free", "1: pipeline finished"}, delegate.received())
+	assert.Equal(t, []string{"1: pipeline finished"}, delegate.plain, "notifications are markup")
+}
+
+func TestOutboxGateway_mentions(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	delegate := &flakyGateway{}
+	o := NewOutboxGateway(ioutil.Discard, delegate, &outbox.RepositoryMock{}, time.Second, fake)
+	var delivered []string
+	o.OnDelivered(func(userId string, kind Kind) { delivered = append(delivered, userId+": "+string(kind)) })
+
+	o.Mention("C1", "1", KindYouAreSecond, "you are the second")
+	o.Mention("C1", "2", KindYourTurn, "your turn")
+	o.Mention("C1", "1", KindYourTurn, "your turn")
+	fake.Advance(time.Second)
+	o.deliverDue()
+	assert.Equal(t, []string{"C1: <@2> your turn\n<@1> your turn"}, delegate.received(), "a mention supersedes only ones about the same user")
+	assert.Empty(t, delegate.plain)
+	assert.Equal(t, []string{"2: your_turn", "1: your_turn"}, delivered, "listeners get the mentioned users")
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, "&lt;@U1&gt; &amp; co", Escape("<@U1> & co"))
+}
+
+func TestOutboxGateway_notifications_survive_restart(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	repository := &outbox.RepositoryMock{}
+	o := NewOutboxGateway(ioutil.Discard, &flakyGateway{}, repository, time.Second*3, fake)
+	o.Notify("1", KindYourTurn, "your turn")
+
+	delegate := &flakyGateway{}
+	restarted := NewOutboxGateway(ioutil.Discard, delegate, repository, time.Second*3, fake)
+	fake.Advance(time.Second * 3)
+	restarted.deliverDue()
+	assert.Equal(t, []string{"1: your turn"}, delegate.received())
+}
+
+func TestOutboxGateway_Run_waits_by_clock(t *testing.T) {
+	start := time.Now()
+	fake := clock.NewFake(start)
+	delegate := &flakyGateway{}
+	o := NewOutboxGateway(ioutil.Discard, delegate, &outbox.RepositoryMock{}, time.Second*3, fake)
+	go o.Run()
+
+	o.Notify("1", KindYourTurn, "your turn")
+	assert.Eventually(t, func() bool {
+		fake.Advance(time.Second)
+		return len(delegate.received()) == 1
+	}, time.Second, time.Millisecond*10)
+	assert.True(t, fake.Now().Sub(start) >= time.Second*3, "the notification waits for the window")
+}
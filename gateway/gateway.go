@@ -1,17 +1,65 @@
 package gateway
 
 import (
+	"fmt"
 	"github.com/nlopes/slack"
+	"github.com/yonesko/slack-queue-bot/clock"
 	"log"
+	"strings"
 )
 
+//reasons a user can't be notified now
+const (
+	AbsenceAway = "away"
+	AbsenceDnd  = "dnd"
+)
+
+//Gateway sends txt as plain text, Slack markup in it is escaped, except for Notify and Mention
 type Gateway interface {
 	Send(userId, txt string) error
 	SendAndLog(userId, txt string)
+	//SendMarkup sends markup as is, so bot's mentions and dates are rendered, parts from users must be escaped with Escape
+	SendMarkup(userId, markup string) error
+	//Absence is AbsenceAway or AbsenceDnd if the user isn't ready to be notified, empty otherwise
+	Absence(userId string) (string, error)
+	//Notify sends a notification about the queue in markup, it may be merged with others to the same user
+	//or dropped if a later one supersedes it
+	Notify(userId string, kind Kind, markup string)
+	//Mention notifies the user mentioning them in the channel, it is merged like Notify
+	Mention(channel string, userId string, kind Kind, markup string)
+}
+
+//KeyedGateway tells messages sent again by a redelivered event from new ones
+type KeyedGateway interface {
+	Gateway
+	//WithKey sends messages with the idempotency key of the event they are about,
+	//a message with the key, recipient and kind of one sent before is dropped
+	WithKey(key string) Gateway
+}
+
+//WithKey is g sending messages with key if g is a KeyedGateway and key isn't empty, otherwise it is g
+func WithKey(g Gateway, key string) Gateway {
+	if keyed, ok := g.(KeyedGateway); ok && key != "" {
+		return keyed.WithKey(key)
+	}
+	return g
+}
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+//Escape makes txt plain text inside markup, as Slack does for Send
+func Escape(txt string) string {
+	return escaper.Replace(txt)
+}
+
+//MentionMarkup is a mention of the user followed by markup
+func MentionMarkup(userId string, markup string) string {
+	return fmt.Sprintf("<@%s> %s", userId, markup)
 }
 
 type slackGateway struct {
 	slackApi *slack.Client
+	clock    clock.Clock
 }
 
 func (s slackGateway) SendAndLog(userId, txt string) {
@@ -21,8 +69,8 @@ func (s slackGateway) SendAndLog(userId, txt string) {
 	}
 }
 
-func NewSlackGateway(slackApi *slack.Client) *slackGateway {
-	return &slackGateway{slackApi: slackApi}
+func NewSlackGateway(slackApi *slack.Client, clock clock.Clock) *slackGateway {
+	return &slackGateway{slackApi: slackApi, clock: clock}
 }
 
 func (s slackGateway) Send(userId, txt string) error {
@@ -37,3 +85,47 @@ func (s slackGateway) Send(userId, txt string) error {
 	)
 	return err
 }
+
+func (s slackGateway) SendMarkup(userId, markup string) error {
+	if userId == "" {
+		log.Printf("sendMsg user id is empty")
+		return nil
+	}
+	log.Printf("sending markup to %s '%s'", userId, markup)
+	_, _, err := s.slackApi.PostMessage(userId,
+		slack.MsgOptionText(markup, false),
+		slack.MsgOptionAsUser(true),
+	)
+	return err
+}
+
+func (s slackGateway) Notify(userId string, kind Kind, markup string) {
+	if err := s.SendMarkup(userId, markup); err != nil {
+		log.Printf("can't notify %s '%s' %s", userId, markup, err)
+	}
+}
+
+func (s slackGateway) Mention(channel string, userId string, kind Kind, markup string) {
+	s.Notify(channel, kind, MentionMarkup(userId, markup))
+}
+
+func (s slackGateway) Absence(userId string) (string, error) {
+	dnd, err := s.slackApi.GetDNDInfo(&userId)
+	if err != nil {
+		return "", err
+	}
+	now := int(s.clock.Now().Unix())
+	snoozed := dnd.SnoozeEnabled && now < dnd.SnoozeEndTime
+	inDndHours := dnd.Enabled && dnd.NextStartTimestamp <= now && now < dnd.NextEndTimestamp
+	if snoozed || inDndHours {
+		return AbsenceDnd, nil
+	}
+	presence, err := s.slackApi.GetUserPresence(userId)
+	if err != nil {
+		return "", err
+	}
+	if presence.Presence == "away" {
+		return AbsenceAway, nil
+	}
+	return "", nil
+}
@@ -3,6 +3,8 @@ package gateway
 import "log"
 
 type Mock struct {
+	//Absences of users by their ids
+	Absences map[string]string
 }
 
 func (m Mock) Send(userId, txt string) error {
@@ -13,3 +15,19 @@ func (m Mock) Send(userId, txt string) error {
 func (m Mock) SendAndLog(userId, txt string) {
 	_ = m.Send(userId, txt)
 }
+
+func (m Mock) SendMarkup(userId, markup string) error {
+	return m.Send(userId, markup)
+}
+
+func (m Mock) Notify(userId string, kind Kind, markup string) {
+	m.SendAndLog(userId, markup)
+}
+
+func (m Mock) Mention(channel string, userId string, kind Kind, markup string) {
+	m.SendAndLog(channel, MentionMarkup(userId, markup))
+}
+
+func (m Mock) Absence(userId string) (string, error) {
+	return m.Absences[userId], nil
+}
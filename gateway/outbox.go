@@ -0,0 +1,370 @@
+package gateway
+
+import (
+	"fmt"
+	"github.com/nlopes/slack"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/outbox"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	//maxOutboxAttempts is how many times a message is tried before it goes to dead letters
+	maxOutboxAttempts = 10
+	//maxDeadLetters keeps the outbox file small, the oldest dead letters are dropped first
+	maxDeadLetters = 100
+	//maxSentKeys are enough to tell duplicates of events the bus replays, they are the latest ones
+	maxSentKeys      = 1000
+	minOutboxBackoff = time.Second
+	maxOutboxBackoff = time.Minute * 10
+	//outboxIdleInterval is how long the outbox sleeps when nothing is pending
+	outboxIdleInterval = time.Minute
+)
+
+//OutboxGateway persists messages before sending and retries them with exponential backoff,
+//messages to the same user are delivered in order of sending.
+//Notifications wait for the window since the first of them and are sent to a user as one message,
+//they wait in the outbox too, so a restart doesn't lose them
+type OutboxGateway struct {
+	delegate   Gateway
+	repository outbox.Repository
+	window     time.Duration
+	mu         sync.Mutex
+	wake       chan struct{}
+	seq        int
+	clock      clock.Clock
+	logger     *log.Logger
+	listeners  []DeliveryListener
+}
+
+//DeliveryListener is told that a notification of the kind reached the user or was given up on,
+//so whoever waits for the user to read it can start waiting
+type DeliveryListener func(userId string, kind Kind)
+
+func NewOutboxGateway(lumberWriter io.Writer, delegate Gateway, repository outbox.Repository, window time.Duration, clock clock.Clock) *OutboxGateway {
+	return &OutboxGateway{
+		delegate:   delegate,
+		repository: repository,
+		window:     window,
+		wake:       make(chan struct{}, 1),
+		clock:      clock,
+		logger:     log.New(lumberWriter, "outbox: ", log.Lshortfile|log.LstdFlags),
+	}
+}
+
+//OnDelivered adds the listener, it must be called before Run
+func (o *OutboxGateway) OnDelivered(listener DeliveryListener) {
+	o.listeners = append(o.listeners, listener)
+}
+
+//Send fails only if the message can't be persisted, delivery errors are retried.
+//Notifications waiting for their window are sent first to keep the order
+func (o *OutboxGateway) Send(userId, txt string) error {
+	return keyedOutbox{o, ""}.Send(userId, txt)
+}
+
+func (o *OutboxGateway) SendMarkup(userId, markup string) error {
+	return keyedOutbox{o, ""}.SendMarkup(userId, markup)
+}
+
+func (o *OutboxGateway) SendAndLog(userId, txt string) {
+	keyedOutbox{o, ""}.SendAndLog(userId, txt)
+}
+
+//Notify is sent when the window since the first pending notification to the user ends
+func (o *OutboxGateway) Notify(userId string, kind Kind, markup string) {
+	keyedOutbox{o, ""}.Notify(userId, kind, markup)
+}
+
+//Mention is merged with other notifications to the channel, a notification supersedes only ones about the same user
+func (o *OutboxGateway) Mention(channel string, userId string, kind Kind, markup string) {
+	keyedOutbox{o, ""}.Mention(channel, userId, kind, markup)
+}
+
+//WithKey drops a message sent again by a redelivered event, the message is recognized among the latest maxSentKeys ones
+func (o *OutboxGateway) WithKey(key string) Gateway {
+	return keyedOutbox{o, key}
+}
+
+//keyedOutbox sends messages of the outbox with the idempotency key of the event they are about
+type keyedOutbox struct {
+	*OutboxGateway
+	key string
+}
+
+func (k keyedOutbox) Send(userId, txt string) error {
+	return k.enqueue(outbox.Message{UserId: userId, Text: txt, Key: k.key})
+}
+
+func (k keyedOutbox) SendMarkup(userId, markup string) error {
+	return k.enqueue(outbox.Message{UserId: userId, Text: markup, Markup: true, Key: k.key})
+}
+
+func (k keyedOutbox) SendAndLog(userId, txt string) {
+	err := k.Send(userId, txt)
+	if err != nil {
+		k.logger.Printf("can't send %s '%s' %s", userId, txt, err)
+	}
+}
+
+func (k keyedOutbox) Notify(userId string, kind Kind, markup string) {
+	err := k.enqueue(outbox.Message{UserId: userId, Text: markup, Kind: string(kind), Markup: true, Key: k.key})
+	if err != nil {
+		k.logger.Printf("can't notify %s '%s' %s", userId, markup, err)
+	}
+}
+
+func (k keyedOutbox) Mention(channel string, userId string, kind Kind, markup string) {
+	err := k.enqueue(outbox.Message{UserId: channel, About: userId, Text: MentionMarkup(userId, markup), Kind: string(kind), Markup: true, Key: k.key})
+	if err != nil {
+		k.logger.Printf("can't mention %s in %s '%s' %s", userId, channel, markup, err)
+	}
+}
+
+func (o *OutboxGateway) enqueue(message outbox.Message) error {
+	if message.UserId == "" {
+		o.logger.Printf("sendMsg user id is empty")
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	box, err := o.repository.Read()
+	if err != nil {
+		return fmt.Errorf("can't read outbox: %s", err)
+	}
+	if dedup := message.Dedup(); dedup != "" {
+		for _, sent := range box.Sent {
+			if sent == dedup {
+				o.logger.Printf("%s is sent already, drop it", dedup)
+				return nil
+			}
+		}
+		box.Sent = append(box.Sent, dedup)
+		if len(box.Sent) > maxSentKeys {
+			box.Sent = box.Sent[len(box.Sent)-maxSentKeys:]
+		}
+	}
+	o.seq++
+	now := o.clock.Now()
+	message.Id = fmt.Sprintf("%d-%d", now.UnixNano(), o.seq)
+	message.CreatedTs = now
+	if message.Kind != "" {
+		message.NextAttemptTs = now.Add(o.window)
+	} else {
+		for i, m := range box.Pending {
+			if m.UserId == message.UserId && m.Attempts == 0 {
+				box.Pending[i].NextAttemptTs = time.Time{}
+			}
+		}
+	}
+	box.Pending = append(box.Pending, message)
+	if err := o.repository.Save(box); err != nil {
+		return fmt.Errorf("can't save outbox: %s", err)
+	}
+	o.poke()
+	return nil
+}
+
+//poke wakes Run up, a pending wake up is enough
+func (o *OutboxGateway) poke() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *OutboxGateway) Absence(userId string) (string, error) {
+	return o.delegate.Absence(userId)
+}
+
+//Run delivers pending messages until the process exits
+func (o *OutboxGateway) Run() {
+	for {
+		timer := o.clock.AfterFunc(o.deliverDue(), o.poke)
+		<-o.wake
+		timer.Stop()
+	}
+}
+
+//deliverDue tries the first pending message of every user if it's time, and tells how long to wait for the next attempt
+func (o *OutboxGateway) deliverDue() time.Duration {
+	o.mu.Lock()
+	box, err := o.repository.Read()
+	o.mu.Unlock()
+	if err != nil {
+		o.logger.Printf("can't read outbox: %s", err)
+		return outboxIdleInterval
+	}
+	for _, message := range heads(box.Pending) {
+		if !message.NextAttemptTs.After(o.clock.Now()) {
+			o.deliver(run(box.Pending, message))
+		}
+	}
+
+	o.mu.Lock()
+	box, err = o.repository.Read()
+	o.mu.Unlock()
+	if err != nil {
+		o.logger.Printf("can't read outbox: %s", err)
+		return outboxIdleInterval
+	}
+	wait := outboxIdleInterval
+	for _, message := range heads(box.Pending) {
+		if d := message.NextAttemptTs.Sub(o.clock.Now()); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+//heads are the first pending messages of every user, later ones wait for them to keep the order
+func heads(pending []outbox.Message) []outbox.Message {
+	var heads []outbox.Message
+	seen := map[string]bool{}
+	for _, message := range pending {
+		if !seen[message.UserId] {
+			seen[message.UserId] = true
+			heads = append(heads, message)
+		}
+	}
+	return heads
+}
+
+//run is the head and, if it is a notification, notifications to the same user right after it, they are sent as one message.
+//Notifications are markup, so a run is either markup or a single message
+func run(pending []outbox.Message, head outbox.Message) []outbox.Message {
+	messages := []outbox.Message{head}
+	if head.Kind == "" {
+		return messages
+	}
+	after := false
+	for _, m := range pending {
+		if m.Id == head.Id {
+			after = true
+			continue
+		}
+		if !after || m.UserId != head.UserId {
+			continue
+		}
+		if m.Kind == "" {
+			break
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+//deliver sends the run as one message, it is removed if sent, otherwise the head is retried later with the rest of the run.
+//Listeners are told about the notifications of the run once it is sent or given up on
+func (o *OutboxGateway) deliver(messages []outbox.Message) {
+	actual := coalesce(messages, o.logger)
+	send := o.delegate.Send
+	if messages[0].Markup {
+		send = o.delegate.SendMarkup
+	}
+	sendErr := send(messages[0].UserId, joinTexts(actual))
+	if !o.settle(messages, sendErr) {
+		return
+	}
+	for _, m := range actual {
+		if m.Kind == "" {
+			continue
+		}
+		userId := m.About
+		if userId == "" {
+			userId = m.UserId
+		}
+		for _, listener := range o.listeners {
+			listener(userId, Kind(m.Kind))
+		}
+	}
+}
+
+//settle removes the sent run or schedules its retry, it tells if the run is done with, sent or dead
+func (o *OutboxGateway) settle(messages []outbox.Message, sendErr error) bool {
+	head := messages[0]
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	box, err := o.repository.Read()
+	if err != nil {
+		o.logger.Printf("can't read outbox: %s", err)
+		return false
+	}
+	done := sendErr == nil
+	sent := map[string]bool{}
+	for _, m := range messages {
+		sent[m.Id] = true
+	}
+	var pending []outbox.Message
+	dead := box.Dead
+	for _, m := range box.Pending {
+		if !sent[m.Id] {
+			pending = append(pending, m)
+			continue
+		}
+		if sendErr == nil {
+			continue
+		}
+		if m.Id != head.Id {
+			if head.Attempts+1 >= maxOutboxAttempts {
+				dead = append(dead, m)
+			} else {
+				pending = append(pending, m)
+			}
+			continue
+		}
+		m.Attempts++
+		m.LastError = sendErr.Error()
+		if m.Attempts >= maxOutboxAttempts {
+			o.logger.Printf("give up sending %s to %s after %d attempts: %s", m.Id, m.UserId, m.Attempts, sendErr)
+			dead = append(dead, m)
+			done = true
+			continue
+		}
+		delay := backoff(m.Attempts, sendErr)
+		o.logger.Printf("can't send %s to %s, retry in %s: %s", m.Id, m.UserId, delay, sendErr)
+		m.NextAttemptTs = o.clock.Now().Add(delay)
+		pending = append(pending, m)
+	}
+	if len(dead) > maxDeadLetters {
+		o.logger.Printf("drop %d oldest dead letters", len(dead)-maxDeadLetters)
+		dead = dead[len(dead)-maxDeadLetters:]
+	}
+	box.Pending, box.Dead = pending, dead
+	if err := o.repository.Save(box); err != nil {
+		o.logger.Printf("can't save outbox: %s", err)
+		return false
+	}
+	return done
+}
+
+//backoff doubles the delay on every attempt, Slack's Retry-After is honored if it is longer
+func backoff(attempts int, err error) time.Duration {
+	delay := maxOutboxBackoff
+	if attempts < 32 {
+		if d := minOutboxBackoff << uint(attempts-1); d < maxOutboxBackoff {
+			delay = d
+		}
+	}
+	if rateLimited, ok := err.(*slack.RateLimitedError); ok && rateLimited.RetryAfter > delay {
+		delay = rateLimited.RetryAfter
+	}
+	return delay
+}
+
+//DeadLetters are messages that kept failing
+func (o *OutboxGateway) DeadLetters() ([]outbox.Message, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	box, err := o.repository.Read()
+	if err != nil {
+		return nil, err
+	}
+	return box.Dead, nil
+}
@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/outbox"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+//flakyGateway fails sending to users from failures as many times as set
+type flakyGateway struct {
+	Mock
+	mu       sync.Mutex
+	failures map[string][]error
+	sent     []string
+	//plain are messages sent with their markup escaped
+	plain []string
+}
+
+func (g *flakyGateway) Send(userId, txt string) error {
+	err := g.SendMarkup(userId, txt)
+	if err == nil {
+		g.mu.Lock()
+		g.plain = append(g.plain, userId+": "+txt)
+		g.mu.Unlock()
+	}
+	return err
+}
+
+func (g *flakyGateway) SendMarkup(userId, markup string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if errs := g.failures[userId]; len(errs) > 0 {
+		g.failures[userId] = errs[1:]
+		return errs[0]
+	}
+	g.sent = append(g.sent, userId+": "+markup)
+	return nil
+}
+
+func (g *flakyGateway) SendAndLog(userId, txt string) {
+	_ = g.Send(userId, txt)
+}
+
+func (g *flakyGateway) received() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.sent
+}
+
+func TestOutboxGateway_retries_in_order(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	delegate := &flakyGateway{failures: map[string][]error{"1": {&slack.RateLimitedError{RetryAfter: time.Second * 30}}}}
+	repository := &outbox.RepositoryMock{}
+	o := NewOutboxGateway(ioutil.Discard, delegate, repository, 0, fake)
+
+	assert.Nil(t, o.Send("1", "first"))
+	assert.Nil(t, o.Send("1", "second"))
+	assert.Nil(t, o.Send("2", "other"))
+	assert.Equal(t, time.Second*30, o.deliverDue(), "Retry-After is honored")
+	assert.Equal(t, []string{"2: other"}, delegate.sent, "the failed message holds back later ones to the same user only")
+	assert.Len(t, repository.Outbox.Pending, 2)
+	assert.Equal(t, 1, repository.Outbox.Pending[0].Attempts)
+
+	assert.Equal(t, time.Second*30, o.deliverDue(), "nothing is due yet")
+	assert.Equal(t, []string{"2: other"}, delegate.sent)
+
+	fake.Advance(time.Second * 30)
+	o.deliverDue()
+	o.deliverDue()
+	assert.Equal(t, []string{"2: other", "1: first", "1: second"}, delegate.sent)
+	assert.Empty(t, repository.Outbox.Pending)
+}
+
+func TestOutboxGateway_dead_letters(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	var errs []error
+	for i := 0; i < maxOutboxAttempts; i++ {
+		errs = append(errs, errors.New("channel_not_found"))
+	}
+	delegate := &flakyGateway{failures: map[string][]error{"1": errs}}
+	repository := &outbox.RepositoryMock{}
+	o := NewOutboxGateway(ioutil.Discard, delegate, repository, 0, fake)
+
+	assert.Nil(t, o.Send("1", "lost"))
+	assert.Nil(t, o.Send("1", "next"))
+	for i := 0; i < maxOutboxAttempts; i++ {
+		fake.Advance(maxOutboxBackoff)
+		o.deliverDue()
+	}
+	dead, err := o.DeadLetters()
+	assert.Nil(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "lost", dead[0].Text)
+	assert.Equal(t, "channel_not_found", dead[0].LastError)
+
+	o.deliverDue()
+	assert.Equal(t, []string{"1: next"}, delegate.sent, "messages after a dead one are delivered")
+}
+
+func TestOutboxGateway_caps_dead_letters(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	delegate := &flakyGateway{failures: map[string][]error{"1": {errors.New("channel_not_found")}}}
+	var dead []outbox.Message
+	for i := 0; i < maxDeadLetters; i++ {
+		dead = append(dead, outbox.Message{Id: fmt.Sprintf("dead-%d", i)})
+	}
+	repository := &outbox.RepositoryMock{Outbox: outbox.Outbox{
+		Pending: []outbox.Message{{Id: "last", UserId: "1", Attempts: maxOutboxAttempts - 1}},
+		Dead:    dead,
+	}}
+	o := NewOutboxGateway(ioutil.Discard, delegate, repository, 0, fake)
+
+	o.deliverDue()
+	assert.Len(t, repository.Outbox.Dead, maxDeadLetters)
+	assert.Equal(t, "dead-1", repository.Outbox.Dead[0].Id, "the oldest one is dropped")
+	assert.Equal(t, "last", repository.Outbox.Dead[maxDeadLetters-1].Id)
+}
+
+func TestOutboxGateway_WithKey(t *testing.T) {
+	delegate := &flakyGateway{}
+	repository := &outbox.RepositoryMock{}
+	o := NewOutboxGateway(ioutil.Discard, delegate, repository, 0, clock.New())
+
+	assert.Nil(t, WithKey(o, "ev-1").Send("1", "deleted"))
+	assert.Nil(t, WithKey(o, "ev-1").Send("2", "deleted"))
+	assert.Nil(t, WithKey(o, "ev-1").Send("1", "deleted again"))
+	assert.Nil(t, WithKey(o, "ev-2").Send("1", "deleted by the next event"))
+	assert.Nil(t, o.Send("1", "without a key"))
+	assert.Nil(t, o.Send("1", "without a key"))
+	o.deliverDue()
+	o.deliverDue()
+	o.deliverDue()
+	o.deliverDue()
+	assert.Equal(t, []string{"1: deleted", "2: deleted", "1: deleted by the next event", "1: without a key", "1: without a key"}, delegate.received(), "a message about the same event is dropped")
+	assert.Equal(t, []string{"ev-1/1//", "ev-1/2//", "ev-2/1//"}, repository.Outbox.Sent)
+	WithKey(o, "ev-1").Notify("1", KindDeleted, "deleted")
+	assert.Len(t, repository.Outbox.Pending, 1, "a notification is told from a message to the same user")
+}
+
+func TestOutboxGateway_WithKey_caps_sent(t *testing.T) {
+	var sent []string
+	for i := 0; i < maxSentKeys; i++ {
+		sent = append(sent, fmt.Sprintf("ev-%d/1//", i))
+	}
+	repository := &outbox.RepositoryMock{Outbox: outbox.Outbox{Sent: sent}}
+	o := NewOutboxGateway(ioutil.Discard, &flakyGateway{}, repository, 0, clock.New())
+
+	assert.Nil(t, WithKey(o, "last").Send("1", "txt"))
+	assert.Len(t, repository.Outbox.Sent, maxSentKeys)
+	assert.Equal(t, "ev-1/1//", repository.Outbox.Sent[0], "the oldest one is dropped")
+	assert.Nil(t, WithKey(o, "ev-0").Send("1", "txt"))
+	assert.Len(t, repository.Outbox.Pending, 2, "a dropped key isn't recognized")
+}
+
+func TestOutboxGateway_OnDelivered(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	delegate := &flakyGateway{failures: map[string][]error{"1": {errors.New("ratelimited")}, "2": {errors.New("channel_not_found")}}}
+	repository := &outbox.RepositoryMock{Outbox: outbox.Outbox{
+		Pending: []outbox.Message{{Id: "dying", UserId: "2", Kind: string(KindYourTurn), Attempts: maxOutboxAttempts - 1}},
+	}}
+	o := NewOutboxGateway(ioutil.Discard, delegate, repository, 0, fake)
+	var delivered []string
+	o.OnDelivered(func(userId string, kind Kind) { delivered = append(delivered, userId+": "+string(kind)) })
+
+	o.Notify("1", KindYouAreSecond, "you are the second")
+	o.Notify("1", KindYourTurn, "your turn")
+	assert.Nil(t, o.Send("1", "pipeline finished"))
+	o.deliverDue()
+	assert.Equal(t, []string{"2: your_turn"}, delivered, "listeners aren't left waiting for a notification given up on")
+
+	fake.Advance(maxOutboxBackoff)
+	o.deliverDue()
+	assert.Equal(t, []string{"2: your_turn", "1: your_turn"}, delivered, "superseded and plain messages aren't reported")
+	assert.Equal(t, []string{"1: your turn"}, delegate.received())
+}
+
+func Test_backoff(t *testing.T) {
+	err := errors.New("timeout")
+	assert.Equal(t, time.Second, backoff(1, err))
+	assert.Equal(t, time.Second*8, backoff(4, err))
+	assert.Equal(t, maxOutboxBackoff, backoff(20, err))
+	assert.Equal(t, time.Minute, backoff(1, &slack.RateLimitedError{RetryAfter: time.Minute}))
+}
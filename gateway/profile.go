@@ -0,0 +1,39 @@
+package gateway
+
+import (
+	"github.com/nlopes/slack"
+	"log"
+	"time"
+)
+
+//ProfileGateway changes profiles of users, it needs a user token with users.profile:read and users.profile:write scopes
+type ProfileGateway interface {
+	//SetStatus sets the custom status, empty text and emoji clear it, zero expiration means it never expires
+	SetStatus(userId, text, emoji string, expiration time.Time) error
+	StatusText(userId string) (string, error)
+}
+
+type slackProfileGateway struct {
+	userApi *slack.Client
+}
+
+func NewSlackProfileGateway(userApi *slack.Client) *slackProfileGateway {
+	return &slackProfileGateway{userApi: userApi}
+}
+
+func (s slackProfileGateway) SetStatus(userId, text, emoji string, expiration time.Time) error {
+	var unix int64
+	if !expiration.IsZero() {
+		unix = expiration.Unix()
+	}
+	log.Printf("setting status of %s '%s %s' until %s", userId, emoji, text, expiration)
+	return s.userApi.SetUserCustomStatusWithUser(userId, text, emoji, unix)
+}
+
+func (s slackProfileGateway) StatusText(userId string) (string, error) {
+	profile, err := s.userApi.GetUserProfile(userId, false)
+	if err != nil {
+		return "", err
+	}
+	return profile.StatusText, nil
+}
@@ -0,0 +1,33 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+)
+
+type Status struct {
+	Text       string
+	Emoji      string
+	Expiration time.Time
+}
+
+type ProfileMock struct {
+	mu       sync.Mutex
+	Statuses map[string]Status
+}
+
+func (p *ProfileMock) SetStatus(userId, text, emoji string, expiration time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Statuses == nil {
+		p.Statuses = map[string]Status{}
+	}
+	p.Statuses[userId] = Status{Text: text, Emoji: emoji, Expiration: expiration}
+	return nil
+}
+
+func (p *ProfileMock) StatusText(userId string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Statuses[userId].Text, nil
+}
@@ -4,41 +4,150 @@ import (
 	"fmt"
 	"github.com/magiconair/properties"
 	"log"
+	"regexp"
+	"sort"
+	"strings"
 )
 
-var L labels
+//L is labels of the bot language, use it when there is no recipient to ask for his language
+var L Labels
 
-const (
-	myLanguage      = "russian"
-	defaultLanguage = "english"
+const defaultLanguage = "english"
+
+//languages by their codes
+var languages = map[string]string{
+	"en": defaultLanguage,
+	"ru": "russian",
+}
+
+var (
+	botLanguage string
+	bundles     = map[string]Labels{}
 )
 
-func Init() {
-	var fileNames []string
-	for _, l := range []string{defaultLanguage, myLanguage} {
-		fileNames = append(fileNames, fmt.Sprintf("i18n/%s.properties", l))
+func IsSupported(language string) bool {
+	for _, l := range languages {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+//LanguageByCode finds language by its code, e.g. en
+func LanguageByCode(code string) (string, bool) {
+	language, ok := languages[strings.ToLower(code)]
+	return language, ok
+}
+
+//LanguageByLocale finds language by Slack locale, e.g. ru-RU
+func LanguageByLocale(locale string) (string, bool) {
+	return LanguageByCode(strings.SplitN(locale, "-", 2)[0])
+}
+
+//Codes are codes of all supported languages
+func Codes() []string {
+	var codes []string
+	for code := range languages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+//BotLanguage is the language to use when a user has no preference
+func BotLanguage() string {
+	return botLanguage
+}
+
+//Languages are names of all supported languages
+func Languages() []string {
+	var names []string
+	for _, language := range languages {
+		names = append(names, language)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Translations are values of the label in every language, e.g. to recognize words typed in any of them
+func Translations(label string) []string {
+	var translations []string
+	for _, language := range Languages() {
+		if labels, ok := bundles[language]; ok {
+			if val, ok := labels.Get(label); ok {
+				translations = append(translations, val)
+			}
+		}
+	}
+	return translations
+}
+
+//For returns labels of the language or labels of the bot language if it isn't supported
+func For(language string) Labels {
+	if labels, ok := bundles[language]; ok {
+		return labels
 	}
+	return L
+}
 
-	var err error
-	props, err := properties.LoadFiles(fileNames, properties.UTF8, false)
-	if err != nil {
-		log.Fatalf("can't open file fo i18n: %s", err)
+//Init loads labels of every language falling back to the default language, L is set to labels of language
+func Init(language string) {
+	InitFrom("i18n", language)
+}
+
+//InitFrom is Init with label files read from dir
+func InitFrom(dir string, language string) {
+	bundles = map[string]Labels{}
+	for _, l := range languages {
+		var fileNames []string
+		for _, f := range []string{defaultLanguage, l} {
+			fileNames = append(fileNames, fmt.Sprintf("%s/%s.properties", dir, f))
+		}
+		props, err := properties.LoadFiles(fileNames, properties.UTF8, false)
+		if err != nil {
+			log.Fatalf("can't open file fo i18n: %s", err)
+		}
+		bundles[l] = labelsProp{props, pluralRules[l]}
 	}
-	L = labelsProp{props}
+	botLanguage = language
+	L = For(language)
 }
 
 func TestInit() {
+	bundles = map[string]Labels{}
+	botLanguage = defaultLanguage
 	L = labelsMock{}
 }
 
-type labels interface {
+//Params are values of named placeholders, e.g. {name} in a label is replaced with Params["name"]
+type Params map[string]interface{}
+
+type Labels interface {
 	MustGet(string) string
 	Get(string) (string, bool)
 	Keys() []string
+	//Format is MustGet with placeholders replaced by params
+	Format(label string, params Params) string
+	//Plural formats label.<category> where the plural category of n is chosen by rules of the language,
+	//{count} is replaced by n
+	Plural(label string, n int, params Params) string
+}
+
+var placeholderRe = regexp.MustCompile(`\{(\w+)\}`)
+
+func format(txt string, params Params) string {
+	return placeholderRe.ReplaceAllStringFunc(txt, func(placeholder string) string {
+		if val, ok := params[placeholder[1:len(placeholder)-1]]; ok {
+			return fmt.Sprint(val)
+		}
+		return placeholder
+	})
 }
 
 type labelsProp struct {
-	P *properties.Properties
+	P      *properties.Properties
+	plural pluralRule
 }
 
 func (l labelsProp) Keys() []string {
@@ -53,6 +162,22 @@ func (l labelsProp) MustGet(lbl string) string {
 	return l.P.MustGetString(lbl)
 }
 
+func (l labelsProp) Format(lbl string, params Params) string {
+	return format(l.MustGet(lbl), params)
+}
+
+func (l labelsProp) Plural(lbl string, n int, params Params) string {
+	withCount := Params{"count": n}
+	for k, v := range params {
+		withCount[k] = v
+	}
+	txt, ok := l.Get(lbl + "." + l.plural.category(n))
+	if !ok {
+		txt = l.MustGet(lbl + "." + pluralOther)
+	}
+	return format(txt, withCount)
+}
+
 type labelsMock struct {
 }
 
@@ -60,6 +185,14 @@ func (l labelsMock) MustGet(string) string {
 	return ""
 }
 
+func (l labelsMock) Format(string, Params) string {
+	return ""
+}
+
+func (l labelsMock) Plural(string, int, Params) string {
+	return ""
+}
+
 func (l labelsMock) Get(string) (string, bool) {
 	panic("implement me labelsMock Get")
 }
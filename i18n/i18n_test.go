@@ -0,0 +1,39 @@
+package i18n
+
+import (
+	"github.com/magiconair/properties"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLabels_Format(t *testing.T) {
+	labels := labelsProp{properties.MustLoadString("greeting=Hi {name}, {unknown} stays"), pluralRules["english"]}
+	assert.Equal(t, "Hi Bob, {unknown} stays", labels.Format("greeting", Params{"name": "Bob"}))
+}
+
+func TestLabels_Plural(t *testing.T) {
+	labels := labelsProp{properties.MustLoadString(`
+minutes.one={count} минуту {who}
+minutes.few={count} минуты {who}
+minutes.many={count} минут {who}
+minutes.other={count} минуты {who}`), pluralRules["russian"]}
+	tests := map[int]string{
+		1:   "1 минуту",
+		2:   "2 минуты",
+		5:   "5 минут",
+		11:  "11 минут",
+		12:  "12 минут",
+		21:  "21 минуту",
+		22:  "22 минуты",
+		111: "111 минут",
+		0:   "0 минут",
+	}
+	for n, want := range tests {
+		assert.Equal(t, want+" Bob", labels.Plural("minutes", n, Params{"who": "Bob"}))
+	}
+}
+
+func TestLabels_Plural_falls_back_to_other(t *testing.T) {
+	labels := labelsProp{properties.MustLoadString("minutes.other={count} min"), pluralRules["english"]}
+	assert.Equal(t, "1 min", labels.Plural("minutes", 1, nil))
+}
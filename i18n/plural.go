@@ -0,0 +1,49 @@
+package i18n
+
+//plural categories of CLDR, see http://cldr.unicode.org/index/cldr-spec/plural-rules
+const (
+	pluralOne   = "one"
+	pluralFew   = "few"
+	pluralMany  = "many"
+	pluralOther = "other"
+)
+
+//pluralRule chooses a plural category of a whole number
+type pluralRule struct {
+	//categories a plural label must define in the language
+	categories []string
+	category   func(n int) string
+}
+
+var pluralRules = map[string]pluralRule{
+	"english": {
+		categories: []string{pluralOne, pluralOther},
+		category: func(n int) string {
+			if n == 1 {
+				return pluralOne
+			}
+			return pluralOther
+		},
+	},
+	"russian": {
+		categories: []string{pluralOne, pluralFew, pluralMany, pluralOther},
+		category: func(n int) string {
+			if n < 0 {
+				n = -n
+			}
+			mod10, mod100 := n%10, n%100
+			if mod10 == 1 && mod100 != 11 {
+				return pluralOne
+			}
+			if mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14) {
+				return pluralFew
+			}
+			return pluralMany
+		},
+	},
+}
+
+//PluralCategories are categories every plural label must define in the language
+func PluralCategories(language string) []string {
+	return pluralRules[language].categories
+}
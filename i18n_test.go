@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"github.com/magiconair/properties"
 	"github.com/yonesko/slack-queue-bot/i18n"
 	"go/ast"
 	"go/parser"
@@ -12,80 +13,133 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
+//labelUsages are labels used in code by how they are got
+type labelUsages struct {
+	//plain are got as is or with named placeholders
+	plain map[string]struct{}
+	//plural are prefixes of label.<category>
+	plural map[string]struct{}
+	//nonAscii are string literals which are most likely user-facing texts hidden from translation
+	nonAscii []string
+}
+
 func TestAllLabelsAreUsedAndDefined(t *testing.T) {
-	i18n.Init()
-	usedLabels := collectLabelsInProject()
-	if len(usedLabels) == 0 {
+	usages := collectLabelsInProject()
+	if len(usages.plain) == 0 {
 		t.Error("no labels are used, use some or skip this test")
 	}
-	for l := range usedLabels {
-		if val, ok := i18n.L.Get(l); !ok || len(strings.TrimSpace(val)) == 0 {
-			t.Errorf("label %s is undefined", l)
-		}
+	for _, l := range usages.nonAscii {
+		t.Errorf("non-ASCII literal %s, move it to a label", l)
 	}
-	for _, l := range i18n.L.Keys() {
-		if _, ok := usedLabels[l]; !ok {
-			t.Errorf("label %s is unused\n", l)
+	for _, language := range i18n.Languages() {
+		own := properties.MustLoadFile(fmt.Sprintf("i18n/%s.properties", language), properties.UTF8)
+		for l := range usages.plain {
+			if val, ok := own.Get(l); !ok || len(strings.TrimSpace(val)) == 0 {
+				t.Errorf("label %s is undefined in %s", l, language)
+			}
+		}
+		for l := range usages.plural {
+			for _, category := range i18n.PluralCategories(language) {
+				if val, ok := own.Get(l + "." + category); !ok || len(strings.TrimSpace(val)) == 0 {
+					t.Errorf("plural label %s.%s is undefined in %s", l, category, language)
+				}
+			}
+		}
+		for _, l := range own.Keys() {
+			if !usages.uses(l) {
+				t.Errorf("label %s is unused in %s\n", l, language)
+			}
 		}
 	}
 }
 
+func (u labelUsages) uses(label string) bool {
+	if _, ok := u.plain[label]; ok {
+		return true
+	}
+	if i := strings.LastIndex(label, "."); i != -1 {
+		_, ok := u.plural[label[:i]]
+		return ok
+	}
+	return false
+}
+
 func shouldScan(info os.FileInfo) bool {
 	return !info.IsDir() && strings.HasSuffix(info.Name(), ".go") && !strings.HasSuffix(info.Name(), "_test.go")
 }
-func collectLabelsInProject() map[string]struct{} {
-	usedLabels := map[string]struct{}{}
+func collectLabelsInProject() labelUsages {
+	usages := labelUsages{plain: map[string]struct{}{}, plural: map[string]struct{}{}}
 	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
 		if shouldScan(info) {
-			for k := range extractLabelsFromFile(path) {
-				usedLabels[k] = struct{}{}
-			}
+			extractLabelsFromFile(path, &usages)
 		}
 		return nil
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
-	return usedLabels
+	return usages
 }
 
-func extractLabelsFromFile(filepath string) map[string]struct{} {
-	node, err := parser.ParseFile(token.NewFileSet(), filepath, nil, parser.ParseComments)
+func extractLabelsFromFile(filepath string, usages *labelUsages) {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, filepath, nil, parser.ParseComments)
 	if err != nil {
 		log.Fatal(err)
 	}
-	usedLabels := map[string]struct{}{}
-	if containsI18nPackage(node) {
-		ast.Inspect(node, func(n ast.Node) bool {
-			callExpr, ok := n.(*ast.CallExpr)
-			if !ok {
-				return true
-			}
-			fun, ok := callExpr.Fun.(*ast.SelectorExpr)
-			if !ok {
-				return true
-			}
-			if fun.Sel.Name == "MustGet" {
-				val, err := strconv.Unquote(callExpr.Args[0].(*ast.BasicLit).Value)
-				if err != nil {
-					panic(fmt.Errorf("strconv.Unquote %s", err))
-				}
-				usedLabels[val] = struct{}{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING && !isAscii(unquote(lit)) {
+			usages.nonAscii = append(usages.nonAscii, fmt.Sprintf("%s at %s", lit.Value, fset.Position(lit.Pos())))
+		}
+		//fields like helpLabel hold names of labels got later
+		if kv, ok := n.(*ast.KeyValueExpr); ok {
+			key, isIdent := kv.Key.(*ast.Ident)
+			lit, isLit := kv.Value.(*ast.BasicLit)
+			if isIdent && isLit && lit.Kind == token.STRING && strings.HasSuffix(key.Name, "Label") {
+				usages.plain[unquote(lit)] = struct{}{}
 			}
+		}
+		callExpr, ok := n.(*ast.CallExpr)
+		if !ok || len(callExpr.Args) == 0 {
+			return true
+		}
+		fun, ok := callExpr.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		//labels are got from i18n.L or from labels of a recipient, so any of these calls with a literal counts
+		lit, ok := callExpr.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
 			return true
-		})
+		}
+		switch {
+		case fun.Sel.Name == "MustGet" || fun.Sel.Name == "Translations":
+			usages.plain[unquote(lit)] = struct{}{}
+		case fun.Sel.Name == "Format" && len(callExpr.Args) == 2:
+			usages.plain[unquote(lit)] = struct{}{}
+		case fun.Sel.Name == "Plural" && len(callExpr.Args) == 3:
+			usages.plural[unquote(lit)] = struct{}{}
+		}
+		return true
+	})
+}
+
+func unquote(lit *ast.BasicLit) string {
+	val, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		panic(fmt.Errorf("strconv.Unquote %s", err))
 	}
-	return usedLabels
+	return val
 }
 
-func containsI18nPackage(f *ast.File) bool {
-	for _, imp := range f.Imports {
-		if imp.Path.Value == "\"github.com/yonesko/slack-queue-bot/i18n\"" {
-			return true
+func isAscii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
 		}
 	}
-	return false
-
+	return true
 }
@@ -0,0 +1,242 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Record is an event sent to the bus
+type Record struct {
+	Seq int64 `json:"seq"`
+	//Type is the name of the event type, e.g. NewHolderEvent
+	Type  string          `json:"type"`
+	Ts    time.Time       `json:"ts"`
+	Event json.RawMessage `json:"event"`
+}
+
+//Journal keeps events until every listener handles them, so they survive restarts
+type Journal struct {
+	//LastSeq is seq of the last event ever sent, it goes on after records are compacted
+	LastSeq int64 `json:"last_seq"`
+	//Records are in order of sending
+	Records []Record `json:"records"`
+	//Checkpoints are seq of the last event every listener is done with
+	Checkpoints map[string]int64 `json:"checkpoints"`
+}
+
+type Repository interface {
+	Read() (Journal, error)
+	//Append adds the record after the others, it doesn't rewrite them
+	Append(Record) error
+	//Checkpoint saves seq of the last event the listener is done with, listeners don't wait for each other
+	Checkpoint(name string, seq int64) error
+	//Compact drops records every listener of checkpoints is done with, except the last one to keep LastSeq,
+	//and checkpoints of listeners that are gone
+	Compact(checkpoints map[string]int64) error
+}
+
+//fileRepository keeps records as JSON lines in filename, every checkpoint in its own file in filename.checkpoints
+type fileRepository struct {
+	filename       string
+	checkpointsDir string
+	//mu guards the records file, checkpoints are written by their listeners only
+	mu sync.Mutex
+}
+
+func NewRepository(filename string) *fileRepository {
+	createDbIfNeed(filepath.Dir(filename))
+	checkpointsDir := filename + ".checkpoints"
+	createDbIfNeed(checkpointsDir)
+	return &fileRepository{filename: filename, checkpointsDir: checkpointsDir}
+}
+
+func createDbIfNeed(dir string) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (f *fileRepository) Read() (Journal, error) {
+	f.mu.Lock()
+	records, err := f.readRecords()
+	f.mu.Unlock()
+	if err != nil {
+		return Journal{}, err
+	}
+	checkpoints, err := f.readCheckpoints()
+	if err != nil {
+		return Journal{}, err
+	}
+	journal := Journal{Records: records, Checkpoints: checkpoints}
+	if len(records) > 0 {
+		journal.LastSeq = records[len(records)-1].Seq
+	}
+	//checkpoints are ahead of records if the records file is lost
+	for _, seq := range checkpoints {
+		if seq > journal.LastSeq {
+			journal.LastSeq = seq
+		}
+	}
+	return journal, nil
+}
+
+//readRecords skips a torn last line left by a crash while appending
+func (f *fileRepository) readRecords() ([]Record, error) {
+	file, err := os.Open(f.filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Printf("skip corrupted journal record %q: %s", scanner.Text(), err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func (f *fileRepository) readCheckpoints() (map[string]int64, error) {
+	files, err := ioutil.ReadDir(f.checkpointsDir)
+	if os.IsNotExist(err) {
+		return map[string]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := map[string]int64{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(f.checkpointsDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		seq, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+		if err != nil {
+			log.Printf("skip corrupted checkpoint of %s: %s", file.Name(), err)
+			continue
+		}
+		checkpoints[file.Name()] = seq
+	}
+	return checkpoints, nil
+}
+
+//Append writes the record as one line, so a crash tears the last line only,
+//the torn line is ended first to keep the record apart from it
+func (f *fileRepository) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	_, err = file.Write(line)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (f *fileRepository) Checkpoint(name string, seq int64) error {
+	return writeAtomically(filepath.Join(f.checkpointsDir, name), []byte(strconv.FormatInt(seq, 10)))
+}
+
+func (f *fileRepository) Compact(checkpoints map[string]int64) error {
+	existing, err := f.readCheckpoints()
+	if err != nil {
+		return err
+	}
+	for name := range existing {
+		if _, ok := checkpoints[name]; !ok {
+			if err := os.Remove(filepath.Join(f.checkpointsDir, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	records, err := f.readRecords()
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	oldest := records[len(records)-1].Seq
+	for _, seq := range checkpoints {
+		if seq < oldest {
+			oldest = seq
+		}
+	}
+	var content []byte
+	for i, r := range records {
+		if r.Seq <= oldest && i < len(records)-1 {
+			continue
+		}
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		content = append(append(content, line...), '\n')
+	}
+	return writeAtomically(f.filename, content)
+}
+
+//writeAtomically replaces the file with content, readers see either the old content or the new one
+func writeAtomically(filename string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
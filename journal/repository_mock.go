@@ -0,0 +1,67 @@
+package journal
+
+import "sync"
+
+type RepositoryMock struct {
+	mu      sync.Mutex
+	Journal Journal
+}
+
+//Read copies records and checkpoints like reading a file does, so callers can't change the saved journal
+func (r *RepositoryMock) Read() (Journal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	checkpoints := map[string]int64{}
+	for name, seq := range r.Journal.Checkpoints {
+		checkpoints[name] = seq
+	}
+	return Journal{
+		LastSeq:     r.Journal.LastSeq,
+		Records:     append([]Record(nil), r.Journal.Records...),
+		Checkpoints: checkpoints,
+	}, nil
+}
+
+func (r *RepositoryMock) Append(record Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Journal.Records = append(r.Journal.Records, record)
+	if record.Seq > r.Journal.LastSeq {
+		r.Journal.LastSeq = record.Seq
+	}
+	return nil
+}
+
+func (r *RepositoryMock) Checkpoint(name string, seq int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Journal.Checkpoints == nil {
+		r.Journal.Checkpoints = map[string]int64{}
+	}
+	r.Journal.Checkpoints[name] = seq
+	return nil
+}
+
+func (r *RepositoryMock) Compact(checkpoints map[string]int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range r.Journal.Checkpoints {
+		if _, ok := checkpoints[name]; !ok {
+			delete(r.Journal.Checkpoints, name)
+		}
+	}
+	oldest := r.Journal.LastSeq
+	for _, seq := range checkpoints {
+		if seq < oldest {
+			oldest = seq
+		}
+	}
+	var records []Record
+	for i, record := range r.Journal.Records {
+		if record.Seq > oldest || i == len(r.Journal.Records)-1 {
+			records = append(records, record)
+		}
+	}
+	r.Journal.Records = records
+	return nil
+}
@@ -0,0 +1,101 @@
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func record(seq int64) Record {
+	return Record{Seq: seq, Type: "NewHolderEvent", Ts: time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC), Event: []byte(`{"current_holder_user_id":"1"}`)}
+}
+
+func TestFileRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	repository := NewRepository(filepath.Join(dir, "db", "journal.json"))
+
+	j, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Journal{Checkpoints: map[string]int64{}}, j, "missing files are an empty journal")
+
+	assert.Nil(t, repository.Append(record(1)))
+	assert.Nil(t, repository.Append(record(2)))
+	assert.Nil(t, repository.Checkpoint("notify", 1))
+	assert.Nil(t, repository.Checkpoint("webhooks", 2))
+	assert.Nil(t, repository.Checkpoint("webhooks", 2), "a checkpoint is overwritten")
+	j, err = repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Journal{LastSeq: 2, Records: []Record{record(1), record(2)}, Checkpoints: map[string]int64{"notify": 1, "webhooks": 2}}, j)
+}
+
+func TestFileRepository_Compact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "journal.json")
+	repository := NewRepository(filename)
+	for seq := int64(1); seq <= 3; seq++ {
+		assert.Nil(t, repository.Append(record(seq)))
+	}
+	assert.Nil(t, repository.Checkpoint("notify", 2))
+	assert.Nil(t, repository.Checkpoint("gone", 0))
+
+	assert.Nil(t, repository.Compact(map[string]int64{"notify": 2, "webhooks": 3}))
+	j, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, []Record{record(3)}, j.Records)
+	assert.Equal(t, map[string]int64{"notify": 2}, j.Checkpoints, "checkpoints of listeners that are gone are dropped")
+
+	assert.Nil(t, repository.Compact(map[string]int64{"notify": 3}))
+	j, err = repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, []Record{record(3)}, j.Records, "the last record is kept")
+	assert.Equal(t, int64(3), j.LastSeq)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"journal.json", "journal.json.checkpoints"}, names, "no temporary files are left")
+}
+
+func TestFileRepository_LastSeq_without_records(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	repository := NewRepository(filepath.Join(dir, "journal.json"))
+	assert.Nil(t, repository.Checkpoint("notify", 7))
+	j, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), j.LastSeq, "seq goes on from checkpoints if the records are lost")
+}
+
+func TestFileRepository_torn_record(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "journal.json")
+	repository := NewRepository(filename)
+	assert.Nil(t, repository.Append(record(1)))
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.WriteString(`{"seq":2,"ty`)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	j, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, []Record{record(1)}, j.Records, "a record torn by a crash is skipped")
+
+	assert.Nil(t, repository.Append(record(3)))
+	j, err = repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, []Record{record(1), record(3)}, j.Records, "a record after the torn one is read")
+}
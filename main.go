@@ -3,10 +3,21 @@ package main
 import (
 	_ "github.com/motemen/go-loghttp/global" //log HTTP req and resp
 	"github.com/yonesko/slack-queue-bot/app"
+	"github.com/yonesko/slack-queue-bot/config"
 	"github.com/yonesko/slack-queue-bot/i18n"
+	"log"
+	"os"
 )
 
 func main() {
-	i18n.Init()
-	app.NewApp().Run()
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		configFile = "slack-queue-bot.yml"
+	}
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	i18n.Init(cfg.Language)
+	app.NewApp(cfg).Run()
 }
@@ -3,17 +3,96 @@ package model
 import "time"
 
 type NewHolderEvent struct {
-	CurrentHolderUserId string
-	PrevHolderUserId    string
-	AuthorUserId        string
-	Ts                  time.Time
+	CurrentHolderUserId string    `json:"current_holder_user_id"`
+	PrevHolderUserId    string    `json:"prev_holder_user_id"`
+	AuthorUserId        string    `json:"author_user_id"`
+	Ts                  time.Time `json:"ts"`
 }
 
 type NewSecondEvent struct {
-	CurrentSecondUserId string
+	CurrentSecondUserId string `json:"current_second_user_id"`
 }
 
 type DeletedEvent struct {
-	AuthorUserId  string
-	DeletedUserId string
+	AuthorUserId  string `json:"author_user_id"`
+	DeletedUserId string `json:"deleted_user_id"`
+}
+
+//PositionChangedEvent is sent when anyone's position changes, it has every entity before and after the change
+type PositionChangedEvent struct {
+	AuthorUserId string           `json:"author_user_id"`
+	Changes      []PositionChange `json:"changes"`
+	//HoldTs is when the current holder took the queue, to estimate waiting
+	HoldTs time.Time `json:"hold_ts"`
+	Ts     time.Time `json:"ts"`
+}
+
+//PositionChange has zero based indexes, -1 is out of the queue
+type PositionChange struct {
+	UserId   string `json:"user_id"`
+	OldIndex int    `json:"old_index"`
+	NewIndex int    `json:"new_index"`
+}
+
+func (p PositionChange) Changed() bool {
+	return p.OldIndex != p.NewIndex
+}
+
+//QueueOperation is what events of operations on the queue have in common, they tell the intent of a change
+type QueueOperation struct {
+	AuthorUserId string `json:"author_user_id"`
+	//Queue is user ids in order of the queue after the operation
+	Queue []string `json:"queue"`
+	//Positions are indexes of everyone before and after the operation, unchanged ones included
+	Positions []PositionChange `json:"positions"`
+	Ts        time.Time        `json:"ts"`
+}
+
+func (q QueueOperation) Operation() QueueOperation {
+	return q
+}
+
+//OperationEvent is any of the events of operations on the queue
+type OperationEvent interface {
+	Operation() QueueOperation
+}
+
+type AddedEvent struct {
+	QueueOperation
+	UserId string `json:"user_id"`
+}
+
+//PassedEvent is sent when the author passes their turn to the next one
+type PassedEvent struct {
+	QueueOperation
+	ToUserId string `json:"to_user_id"`
+}
+
+type AckedEvent struct {
+	QueueOperation
+}
+
+type CleanedEvent struct {
+	QueueOperation
+}
+
+//HolderTimedOutEvent is sent when the holder loses the turn without acking it, the author is the holder
+type HolderTimedOutEvent struct {
+	QueueOperation
+	NewHolderUserId string `json:"new_holder_user_id"`
+	//Absence is why the holder is skipped by the presence policy, empty if the ack deadline passed
+	Absence string `json:"absence,omitempty"`
+}
+
+type PoppedEvent struct {
+	QueueOperation
+	PoppedUserId string `json:"popped_user_id"`
+}
+
+//ReleasedEvent is sent when CI releases the queue after a pipeline of the holder, the author is the holder
+type ReleasedEvent struct {
+	QueueOperation
+	ReleasedUserId string `json:"released_user_id"`
+	//Outcome is what CI tells about the pipeline, e.g. success
+	Outcome string `json:"outcome"`
 }
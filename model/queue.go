@@ -6,6 +6,20 @@ type Queue struct {
 	Entities         []QueueEntity `json:"entities"`
 	HoldTs           time.Time     `json:"hold_ts"`
 	HolderIsSleeping bool          `json:"holder_is_sleeping"`
+	//Deferrals are users the bot hasn't notified of their turn as they were absent
+	Deferrals map[string]Deferral `json:"deferrals,omitempty"`
+	//AckDeadlineTs is when the turn of the sleeping holder is passed, it is zero until they have got their turn notification
+	AckDeadlineTs time.Time `json:"ack_deadline_ts"`
+	//HolderIsNotified tells the turn notification is in the outbox, so it isn't sent again after a restart
+	HolderIsNotified bool `json:"holder_is_notified"`
+}
+
+//Deferral is why a user hasn't been notified of their turn
+type Deferral struct {
+	//Absence is away or dnd
+	Absence string `json:"absence"`
+	//Skipped tells the turn was passed to the next one, otherwise the bot waits for the user to come back
+	Skipped bool `json:"skipped"`
 }
 
 type QueueEntity struct {
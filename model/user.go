@@ -4,4 +4,7 @@ type User struct {
 	Id          string `json:"id"`
 	FullName    string `json:"full_name"`
 	DisplayName string `json:"display_name"`
+	Locale      string `json:"locale"`
+	//TZ is a name of the user's timezone in IANA database, e.g. Europe/Moscow
+	TZ string `json:"tz"`
 }
@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//Message is a direct message to a user waiting to be delivered
+type Message struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	Text      string    `json:"text"`
+	CreatedTs time.Time `json:"created_ts"`
+	Attempts  int       `json:"attempts"`
+	//NextAttemptTs is when the message is retried, it is zero for a message not tried yet
+	NextAttemptTs time.Time `json:"next_attempt_ts"`
+	LastError     string    `json:"last_error,omitempty"`
+	//Kind of a notification about the queue, notifications to a user are merged, plain messages have no kind
+	Kind string `json:"kind,omitempty"`
+	//About is the user mentioned by a notification to a channel
+	About string `json:"about,omitempty"`
+	//Markup is sent as is, otherwise Slack markup in the text is escaped
+	Markup bool `json:"markup,omitempty"`
+	//Key is the idempotency key of the event the message is about, empty if it isn't about an event
+	Key string `json:"key,omitempty"`
+}
+
+//Dedup identifies the message among the ones about the same event, it is empty if the message has no key
+func (m Message) Dedup() string {
+	if m.Key == "" {
+		return ""
+	}
+	return m.Key + "/" + m.UserId + "/" + m.About + "/" + m.Kind
+}
+
+//Outbox keeps messages until they are delivered, so they survive Slack failures and restarts
+type Outbox struct {
+	//Pending are in order of sending
+	Pending []Message `json:"pending"`
+	//Dead are messages that kept failing, for admins to inspect
+	Dead []Message `json:"dead"`
+	//Sent are Dedup of the latest messages with keys, the oldest are dropped first
+	Sent []string `json:"sent,omitempty"`
+}
+
+type Repository interface {
+	Read() (Outbox, error)
+	Save(Outbox) error
+}
+
+type fileRepository struct {
+	filename string
+}
+
+func NewRepository(filename string) *fileRepository {
+	createDbIfNeed(filepath.Dir(filename))
+	return &fileRepository{filename: filename}
+}
+func createDbIfNeed(dir string) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+//Save writes a temp file and renames it over the old one, so a crash never leaves a half-written outbox
+func (f *fileRepository) Save(outbox Outbox) error {
+	bytes, err := json.Marshal(outbox)
+	if err != nil {
+		return err
+	}
+	return writeAtomically(f.filename, bytes)
+}
+
+//writeAtomically replaces the file with content, readers see either the old content or the new one
+func writeAtomically(filename string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (f *fileRepository) Read() (Outbox, error) {
+	bytes, err := ioutil.ReadFile(f.filename)
+	if os.IsNotExist(err) {
+		return Outbox{}, nil
+	}
+	if err != nil {
+		return Outbox{}, err
+	}
+	outbox := &Outbox{}
+	err = json.Unmarshal(bytes, outbox)
+	if err != nil {
+		return Outbox{}, err
+	}
+	return *outbox, nil
+}
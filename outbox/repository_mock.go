@@ -0,0 +1,19 @@
+package outbox
+
+type RepositoryMock struct {
+	Outbox Outbox
+}
+
+//Read copies messages like reading a file does, so callers can't change the saved outbox by appending
+func (r *RepositoryMock) Read() (Outbox, error) {
+	return Outbox{
+		Pending: append([]Message(nil), r.Outbox.Pending...),
+		Dead:    append([]Message(nil), r.Outbox.Dead...),
+		Sent:    append([]string(nil), r.Outbox.Sent...),
+	}, nil
+}
+
+func (r *RepositoryMock) Save(outbox Outbox) error {
+	r.Outbox = outbox
+	return nil
+}
@@ -0,0 +1,63 @@
+package outbox
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	repository := NewRepository(filepath.Join(dir, "db", "outbox.json"))
+
+	box, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Outbox{}, box, "missing file is an empty outbox")
+
+	createdTs := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	box = Outbox{
+		Pending: []Message{{Id: "1", UserId: "U1", Text: "your turn", CreatedTs: createdTs}},
+		Dead:    []Message{{Id: "0", UserId: "U2", Text: "lost", CreatedTs: createdTs, Attempts: 10, LastError: "channel_not_found"}},
+	}
+	assert.Nil(t, repository.Save(box))
+	read, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, box, read)
+}
+
+func TestFileRepository_Save_replaces_file(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "outbox.json")
+	repository := NewRepository(filename)
+	assert.Nil(t, repository.Save(Outbox{Pending: []Message{{Id: "1", UserId: "U1", Text: "your turn"}}}))
+	//a temp file left by a crash while saving doesn't break the outbox
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, ".outbox.json.tmp123"), []byte(`{"pend`), 0644))
+	assert.Nil(t, repository.Save(Outbox{}))
+
+	read, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Outbox{}, read)
+	info, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode())
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2, "no temporary files are left but the crashed one")
+}
+
+func TestFileRepository_corrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "outbox.json")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("{"), 0644))
+	_, err = NewRepository(filename).Read()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,63 @@
+package preference
+
+import (
+	"fmt"
+	"github.com/yonesko/slack-queue-bot/user"
+	"log"
+	"strings"
+	"time"
+)
+
+//Formatter renders durations and dates for a user in their language and timezone
+type Formatter interface {
+	Duration(userId string, duration time.Duration) string
+	Time(userId string, t time.Time) string
+}
+
+type formatter struct {
+	localizer      Localizer
+	userRepository user.Repository
+}
+
+func NewFormatter(localizer Localizer, userRepository user.Repository) Formatter {
+	return &formatter{localizer: localizer, userRepository: userRepository}
+}
+
+//Duration is like 3 days 5 hours, zero units are skipped
+func (f *formatter) Duration(userId string, duration time.Duration) string {
+	labels := f.localizer.Labels(userId)
+	var parts []string
+	if days := int(duration / (time.Hour * 24)); days != 0 {
+		parts = append(parts, labels.Plural("duration_days", days, nil))
+	}
+	if hours := int(duration % (time.Hour * 24) / time.Hour); hours != 0 {
+		parts = append(parts, labels.Plural("duration_hours", hours, nil))
+	}
+	if minutes := int(duration % time.Hour / time.Minute); minutes != 0 {
+		parts = append(parts, labels.Plural("duration_minutes", minutes, nil))
+	}
+	if seconds := int(duration % time.Minute / time.Second); seconds != 0 {
+		parts = append(parts, labels.Plural("duration_seconds", seconds, nil))
+	}
+	return strings.Join(parts, " ")
+}
+
+//Time is a Slack date token, so every client shows it in the timezone of its user,
+//the fallback is in the language and Slack timezone of the user
+func (f *formatter) Time(userId string, t time.Time) string {
+	fallback := t.In(f.location(userId)).Format(f.localizer.Labels(userId).MustGet("date_layout"))
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), fallback)
+}
+
+func (f *formatter) location(userId string) *time.Location {
+	u, err := f.userRepository.FindById(userId)
+	if err != nil || u.TZ == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(u.TZ)
+	if err != nil {
+		log.Printf("can't load timezone %s of %s: %s", u.TZ, userId, err)
+		return time.Local
+	}
+	return location
+}
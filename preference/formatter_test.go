@@ -0,0 +1,50 @@
+package preference
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"testing"
+	"time"
+)
+
+func TestFormatter_Duration(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	f := mockFormatter(map[string]UserPreferences{"ru": {Language: "russian"}})
+	tests := []struct {
+		duration time.Duration
+		want     string
+		wantRu   string
+	}{
+		{0, "", ""},
+		{time.Second, "1 second", "1 с"},
+		{time.Minute, "1 minute", "1 мин"},
+		{time.Minute + time.Second, "1 minute 1 second", "1 мин 1 с"},
+		{time.Minute + 1, "1 minute", "1 мин"},
+		{time.Hour * 77, "3 days 5 hours", "3 д 5 ч"},
+		{time.Hour*77 + time.Minute*59, "3 days 5 hours 59 minutes", "3 д 5 ч 59 мин"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.duration), func(t *testing.T) {
+			assert.Equal(t, tt.want, f.Duration("en", tt.duration))
+			assert.Equal(t, tt.wantRu, f.Duration("ru", tt.duration))
+		})
+	}
+}
+
+func TestFormatter_Time(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	f := mockFormatter(map[string]UserPreferences{"ru": {Language: "russian"}})
+	ts := time.Date(2020, time.March, 2, 9, 30, 0, 0, time.UTC)
+	assert.Equal(t, "<!date^1583141400^{date_short_pretty} {time}|Mon Mar 2 09:30>", f.Time("en", ts))
+	assert.Equal(t, "<!date^1583141400^{date_short_pretty} {time}|02.03.2020 12:30>", f.Time("ru", ts))
+}
+
+func mockFormatter(users map[string]UserPreferences) Formatter {
+	userRepository := userRepositoryMock{map[string]model.User{
+		"en": {Id: "en", TZ: "UTC"},
+		"ru": {Id: "ru", TZ: "Europe/Moscow"},
+	}}
+	return NewFormatter(NewLocalizer(&RepositoryMock{Preferences{Users: users}}, userRepository), userRepository)
+}
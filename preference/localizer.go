@@ -0,0 +1,45 @@
+package preference
+
+import (
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/user"
+	"log"
+)
+
+//Localizer finds out labels to talk to a user with
+type Localizer interface {
+	Labels(userId string) i18n.Labels
+	Language(userId string) string
+}
+
+type localizer struct {
+	preferenceRepository Repository
+	userRepository       user.Repository
+}
+
+func NewLocalizer(preferenceRepository Repository, userRepository user.Repository) Localizer {
+	return &localizer{preferenceRepository: preferenceRepository, userRepository: userRepository}
+}
+
+func (l *localizer) Labels(userId string) i18n.Labels {
+	return i18n.For(l.Language(userId))
+}
+
+//Language is the language chosen by the user, or the language of his Slack locale, or the default one
+func (l *localizer) Language(userId string) string {
+	preferences, err := l.preferenceRepository.Read()
+	if err != nil {
+		log.Printf("can't read preferences: %s", err)
+	} else if language := preferences.Of(userId).Language; language != "" {
+		return language
+	}
+	u, err := l.userRepository.FindById(userId)
+	if err != nil {
+		log.Printf("can't find user %s: %s", userId, err)
+		return i18n.BotLanguage()
+	}
+	if language, ok := i18n.LanguageByLocale(u.Locale); ok {
+		return language
+	}
+	return i18n.BotLanguage()
+}
@@ -0,0 +1,23 @@
+package preference
+
+import "github.com/yonesko/slack-queue-bot/i18n"
+
+//LocalizerMock talks to everyone in the bot language, it takes the labels when it is made,
+//so goroutines a test leaves behind don't read labels the next test sets up
+type LocalizerMock struct {
+	labels   i18n.Labels
+	language string
+}
+
+//NewLocalizerMock is made after i18n is initialized
+func NewLocalizerMock() LocalizerMock {
+	return LocalizerMock{i18n.L, i18n.BotLanguage()}
+}
+
+func (l LocalizerMock) Labels(string) i18n.Labels {
+	return l.labels
+}
+
+func (l LocalizerMock) Language(string) string {
+	return l.language
+}
@@ -0,0 +1,38 @@
+package preference
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"testing"
+)
+
+type userRepositoryMock struct {
+	users map[string]model.User
+}
+
+func (u userRepositoryMock) FindById(id string) (model.User, error) {
+	return u.users[id], nil
+}
+
+func TestLocalizer_Language(t *testing.T) {
+	i18n.TestInit()
+	preferences := &RepositoryMock{}
+	assert.Nil(t, preferences.Save(Preferences{}.With("1", UserPreferences{Language: "russian"})))
+	localizer := NewLocalizer(preferences, userRepositoryMock{map[string]model.User{
+		"1": {Id: "1", Locale: "en-US"},
+		"2": {Id: "2", Locale: "ru-RU"},
+		"3": {Id: "3", Locale: "de-DE"},
+	}})
+	assert.Equal(t, "russian", localizer.Language("1"), "preference beats locale")
+	assert.Equal(t, "russian", localizer.Language("2"))
+	assert.Equal(t, "english", localizer.Language("3"), "unsupported locale falls back to the bot language")
+}
+
+func TestPreferences_With(t *testing.T) {
+	p := Preferences{}.With("1", UserPreferences{Language: "russian"})
+	p2 := p.With("2", UserPreferences{Language: "english"})
+	assert.Equal(t, UserPreferences{}, p.Of("2"))
+	assert.Equal(t, "russian", p2.Of("1").Language)
+	assert.Equal(t, "english", p2.Of("2").Language)
+}
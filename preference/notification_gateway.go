@@ -0,0 +1,49 @@
+package preference
+
+import (
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"log"
+)
+
+//notificationGateway delivers notifications the way each user has chosen for their topic
+type notificationGateway struct {
+	gateway.Gateway
+	repository Repository
+	//channel is where users choosing DeliveryChannel are mentioned, they get DMs if it is empty
+	channel string
+}
+
+func NewNotificationGateway(delegate gateway.Gateway, repository Repository, channel string) *notificationGateway {
+	return &notificationGateway{Gateway: delegate, repository: repository, channel: channel}
+}
+
+//WithKey passes the key on to the delegate, so it tells duplicates whatever way the user has chosen
+func (n *notificationGateway) WithKey(key string) gateway.Gateway {
+	return &notificationGateway{Gateway: gateway.WithKey(n.Gateway, key), repository: n.repository, channel: n.channel}
+}
+
+func (n *notificationGateway) Notify(userId string, kind gateway.Kind, markup string) {
+	topic, ok := topics[kind]
+	if !ok {
+		n.Gateway.Notify(userId, kind, markup)
+		return
+	}
+	preferences, err := n.repository.Read()
+	if err != nil {
+		log.Printf("can't read preferences of %s, notify by DM: %s", userId, err)
+		n.Gateway.Notify(userId, kind, markup)
+		return
+	}
+	switch preferences.Of(userId).Delivery(topic) {
+	case DeliveryOff:
+		log.Printf("%s turned %s notifications off, drop '%s'", userId, topic, markup)
+	case DeliveryChannel:
+		if n.channel == "" {
+			n.Gateway.Notify(userId, kind, markup)
+			return
+		}
+		n.Gateway.Mention(n.channel, userId, kind, markup)
+	default:
+		n.Gateway.Notify(userId, kind, markup)
+	}
+}
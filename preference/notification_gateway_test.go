@@ -0,0 +1,50 @@
+package preference
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"testing"
+)
+
+type recordingGateway struct {
+	gateway.Mock
+	notified []string
+	sent     []string
+}
+
+func (g *recordingGateway) Notify(userId string, kind gateway.Kind, txt string) {
+	g.notified = append(g.notified, userId+": "+txt)
+}
+
+func (g *recordingGateway) Mention(channel string, userId string, kind gateway.Kind, markup string) {
+	g.sent = append(g.sent, channel+": "+gateway.MentionMarkup(userId, markup))
+}
+
+func TestNotificationGateway_Notify(t *testing.T) {
+	repository := &RepositoryMock{}
+	preferences := Preferences{}.
+		With("1", UserPreferences{}.WithDelivery(TopicSecond, DeliveryOff)).
+		With("2", UserPreferences{}.WithDelivery(TopicSecond, DeliveryChannel)).
+		With("4", UserPreferences{}.WithDelivery(TopicHolder, DeliveryOff))
+	assert.Nil(t, repository.Save(preferences))
+	delegate := &recordingGateway{}
+	n := NewNotificationGateway(delegate, repository, "C1")
+
+	n.Notify("1", gateway.KindYouAreSecond, "you are the second")
+	n.Notify("1", gateway.KindYourTurn, "your turn")
+	n.Notify("2", gateway.KindYouAreSecond, "you are the second")
+	n.Notify("3", gateway.KindYouAreSecond, "you are the second")
+	n.Notify("3", gateway.KindPosition, "you are the 3rd")
+	n.Notify("4", gateway.KindYourTurn, "your turn")
+
+	assert.Equal(t, []string{"1: your turn", "3: you are the second", "4: your turn"}, delegate.notified, "the holder can't turn notifications off")
+	assert.Equal(t, []string{"C1: <@2> you are the second"}, delegate.sent)
+}
+
+func TestNotificationGateway_Notify_without_channel(t *testing.T) {
+	repository := &RepositoryMock{}
+	assert.Nil(t, repository.Save(Preferences{}.With("1", UserPreferences{}.WithDelivery(TopicDeleted, DeliveryChannel))))
+	delegate := &recordingGateway{}
+	NewNotificationGateway(delegate, repository, "").Notify("1", gateway.KindDeleted, "you are deleted")
+	assert.Equal(t, []string{"1: you are deleted"}, delegate.notified)
+}
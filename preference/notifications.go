@@ -0,0 +1,81 @@
+package preference
+
+import "github.com/yonesko/slack-queue-bot/gateway"
+
+//Topic is what a notification is about, users choose a delivery for each topic
+type Topic string
+
+const (
+	TopicSecond   Topic = "second"
+	TopicPosition Topic = "position"
+	TopicDeleted  Topic = "deleted"
+	TopicEmpty    Topic = "empty"
+	//TopicHolder are "your turn" and other reminders to the holder
+	TopicHolder Topic = "holder"
+)
+
+//Topics in order of showing
+var Topics = []Topic{TopicSecond, TopicPosition, TopicDeleted, TopicEmpty, TopicHolder}
+
+//Delivery is how a user gets notifications of a topic
+type Delivery string
+
+const (
+	DeliveryDm Delivery = "dm"
+	//DeliveryChannel mentions the user in notify_channel
+	DeliveryChannel Delivery = "channel"
+	DeliveryOff     Delivery = "off"
+)
+
+var Deliveries = []Delivery{DeliveryDm, DeliveryChannel, DeliveryOff}
+
+//defaultDeliveries keep notifications the bot sent before they could be chosen
+var defaultDeliveries = map[Topic]Delivery{
+	TopicSecond:   DeliveryDm,
+	TopicPosition: DeliveryOff,
+	TopicDeleted:  DeliveryDm,
+	TopicEmpty:    DeliveryOff,
+	TopicHolder:   DeliveryDm,
+}
+
+//topics of notification kinds
+var topics = map[gateway.Kind]Topic{
+	gateway.KindYouAreSecond: TopicSecond,
+	gateway.KindPosition:     TopicPosition,
+	gateway.KindDeleted:      TopicDeleted,
+	gateway.KindQueueEmpty:   TopicEmpty,
+	gateway.KindYourTurn:     TopicHolder,
+	gateway.KindPassed:       TopicHolder,
+}
+
+func (t Topic) IsValid() bool {
+	_, ok := defaultDeliveries[t]
+	return ok
+}
+
+func (d Delivery) IsValid() bool {
+	return d == DeliveryDm || d == DeliveryChannel || d == DeliveryOff
+}
+
+//IsValidFor tells if the topic can be delivered so, the holder can't turn their notifications off
+//as their turn is passed by the ack deadline that starts when they are notified
+func (d Delivery) IsValidFor(topic Topic) bool {
+	return d.IsValid() && !(topic == TopicHolder && d == DeliveryOff)
+}
+
+func (u UserPreferences) Delivery(topic Topic) Delivery {
+	if delivery, ok := u.Notifications[topic]; ok && delivery.IsValidFor(topic) {
+		return delivery
+	}
+	return defaultDeliveries[topic]
+}
+
+func (u UserPreferences) WithDelivery(topic Topic, delivery Delivery) UserPreferences {
+	notifications := map[Topic]Delivery{}
+	for t, d := range u.Notifications {
+		notifications[t] = d
+	}
+	notifications[topic] = delivery
+	u.Notifications = notifications
+	return u
+}
@@ -0,0 +1,133 @@
+package preference
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type UserPreferences struct {
+	//Language is a name of i18n language, empty means the language of Slack user's locale
+	Language string `json:"language,omitempty"`
+	//Notifications are deliveries chosen for topics, defaults apply to topics missing here
+	Notifications map[Topic]Delivery `json:"notifications,omitempty"`
+	//AlertPosition is a position the user wants to know they have reached, zero is off
+	AlertPosition int `json:"alert_position,omitempty"`
+	//AlertJumps tells the user when someone jumps ahead of them
+	AlertJumps bool `json:"alert_jumps,omitempty"`
+	//Watch subscribes the user to the queue without joining it, empty is not watching
+	Watch WatchScope `json:"watch,omitempty"`
+}
+
+type Preferences struct {
+	Users map[string]UserPreferences `json:"users"`
+}
+
+func (p Preferences) Of(userId string) UserPreferences {
+	return p.Users[userId]
+}
+
+func (p Preferences) With(userId string, userPreferences UserPreferences) Preferences {
+	users := map[string]UserPreferences{}
+	for id, u := range p.Users {
+		users[id] = u
+	}
+	users[userId] = userPreferences
+	return Preferences{Users: users}
+}
+
+type Repository interface {
+	Read() (Preferences, error)
+	Save(Preferences) error
+}
+
+//fileRepository caches preferences while the file is unchanged, they are read on every label lookup
+type fileRepository struct {
+	filename string
+	mu       sync.Mutex
+	cached   *Preferences
+	modTime  time.Time
+	size     int64
+}
+
+func NewRepository(filename string) *fileRepository {
+	createDbIfNeed(filepath.Dir(filename))
+	return &fileRepository{filename: filename}
+}
+func createDbIfNeed(dir string) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+//Save writes a temp file and renames it over the old one, so a crash never leaves a half-written file
+func (f *fileRepository) Save(preferences Preferences) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bytes, err := json.Marshal(preferences)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.filename), filepath.Base(f.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(bytes)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	f.cache(preferences)
+	return nil
+}
+
+func (f *fileRepository) Read() (Preferences, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.filename)
+	if os.IsNotExist(err) {
+		return Preferences{}, nil
+	}
+	if err != nil {
+		return Preferences{}, err
+	}
+	if f.cached != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return *f.cached, nil
+	}
+	bytes, err := ioutil.ReadFile(f.filename)
+	if err != nil {
+		return Preferences{}, err
+	}
+	preferences := &Preferences{}
+	err = json.Unmarshal(bytes, preferences)
+	if err != nil {
+		return Preferences{}, err
+	}
+	f.cache(*preferences)
+	return *preferences, nil
+}
+
+//cache remembers preferences along with the file state they match, lock must be acquired in caller method
+func (f *fileRepository) cache(preferences Preferences) {
+	info, err := os.Stat(f.filename)
+	if err != nil {
+		f.cached = nil
+		return
+	}
+	f.cached, f.modTime, f.size = &preferences, info.ModTime(), info.Size()
+}
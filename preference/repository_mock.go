@@ -0,0 +1,14 @@
+package preference
+
+type RepositoryMock struct {
+	preferences Preferences
+}
+
+func (r *RepositoryMock) Read() (Preferences, error) {
+	return r.preferences, nil
+}
+
+func (r *RepositoryMock) Save(preferences Preferences) error {
+	r.preferences = preferences
+	return nil
+}
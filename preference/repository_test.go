@@ -0,0 +1,37 @@
+package preference
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preference")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "preferences.json")
+	repository := NewRepository(filename)
+
+	preferences, err := repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, Preferences{}, preferences)
+
+	assert.Nil(t, repository.Save(preferences.With("1", UserPreferences{Language: "english"})))
+	preferences, err = repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, "english", preferences.Of("1").Language)
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1, "temp file is renamed")
+
+	//changes made to the file by someone else are picked up
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"users":{"1":{"language":"russian"}}}`), 0644))
+	assert.Nil(t, os.Chtimes(filename, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	preferences, err = repository.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, "russian", preferences.Of("1").Language)
+}
@@ -0,0 +1,24 @@
+package preference
+
+//WatchScope is what a user watching the queue without joining it is told about
+type WatchScope string
+
+const (
+	//WatchEmpty tells when the queue becomes empty
+	WatchEmpty WatchScope = "empty"
+	//WatchHolder tells when the holder changes
+	WatchHolder WatchScope = "holder"
+	WatchBoth   WatchScope = "both"
+)
+
+func (w WatchScope) IsValid() bool {
+	return w == WatchEmpty || w == WatchHolder || w == WatchBoth
+}
+
+func (w WatchScope) Empty() bool {
+	return w == WatchEmpty || w == WatchBoth
+}
+
+func (w WatchScope) Holder() bool {
+	return w == WatchHolder || w == WatchBoth
+}
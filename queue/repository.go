@@ -5,6 +5,7 @@ import (
 	"github.com/yonesko/slack-queue-bot/model"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 type Repository interface {
@@ -16,13 +17,13 @@ type fileRepository struct {
 	filename string
 }
 
-func NewRepository() *fileRepository {
-	createDbIfNeed()
-	return &fileRepository{filename: "db/slack-queue-bot.db.json"}
+func NewRepository(filename string) *fileRepository {
+	createDbIfNeed(filepath.Dir(filename))
+	return &fileRepository{filename: filename}
 }
-func createDbIfNeed() {
-	if _, err := os.Stat("db"); os.IsNotExist(err) {
-		err := os.Mkdir("db", os.ModePerm)
+func createDbIfNeed(dir string) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err := os.MkdirAll(dir, os.ModePerm)
 		if err != nil {
 			panic(err)
 		}
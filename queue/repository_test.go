@@ -14,7 +14,7 @@ func init() {
 }
 
 func TestFileRepository(t *testing.T) {
-	repository := NewRepository()
+	repository := NewRepository("db/slack-queue-bot.db.json")
 	err := repository.Save(model.Queue{Entities: []model.QueueEntity{{UserId: "54"}, {UserId: "154"}}})
 	if err != nil {
 		t.Error(err)
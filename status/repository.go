@@ -0,0 +1,68 @@
+package status
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//Message is the pinned bot message showing the queue
+type Message struct {
+	//Channel is an id of the channel the message is posted to
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+	//StatusChannel is status_channel the message was posted for, it is empty in messages posted by older versions
+	StatusChannel string `json:"status_channel,omitempty"`
+	//Pinned is false until the message is pinned, pinning is retried on every update
+	Pinned bool `json:"pinned"`
+}
+
+type Repository interface {
+	Read() (Message, error)
+	Save(Message) error
+}
+
+type fileRepository struct {
+	filename string
+}
+
+func NewRepository(filename string) *fileRepository {
+	createDbIfNeed(filepath.Dir(filename))
+	return &fileRepository{filename: filename}
+}
+func createDbIfNeed(dir string) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+func (f *fileRepository) Save(message Message) error {
+	bytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(f.filename, bytes, 0644)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *fileRepository) Read() (Message, error) {
+	bytes, err := ioutil.ReadFile(f.filename)
+	if os.IsNotExist(err) {
+		return Message{}, nil
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	message := &Message{}
+	err = json.Unmarshal(bytes, message)
+	if err != nil {
+		return Message{}, err
+	}
+	return *message, nil
+}
@@ -0,0 +1,14 @@
+package status
+
+type RepositoryMock struct {
+	Message Message
+}
+
+func (r *RepositoryMock) Read() (Message, error) {
+	return r.Message, nil
+}
+
+func (r *RepositoryMock) Save(message Message) error {
+	r.Message = message
+	return nil
+}
@@ -1,15 +1,17 @@
 package impl
 
 import (
-	"fmt"
+	"github.com/yonesko/slack-queue-bot/gateway"
 	"github.com/yonesko/slack-queue-bot/i18n"
 	"github.com/yonesko/slack-queue-bot/model"
 	"github.com/yonesko/slack-queue-bot/usecase"
 	"log"
+	"math"
 	"time"
 )
 
-const waitForAck = time.Minute * 7
+//presencePollInterval is how often presence of an absent holder is checked
+const presencePollInterval = time.Minute
 
 func (s *service) notifyNewHolderAndWaitForAck(newHolderEvent model.NewHolderEvent) {
 	curHolder := newHolderEvent.CurrentHolderUserId
@@ -23,15 +25,175 @@ func (s *service) notifyNewHolderAndWaitForAck(newHolderEvent model.NewHolderEve
 		return
 	}
 
+	s.goNotifyWhenPresent(curHolder)
+}
+
+func (s *service) goNotifyWhenPresent(holder string) {
+	s.notifying.Add(1)
 	go func() {
-		txt := fmt.Sprintf(i18n.L.MustGet("your_turn_came"), waitForAck)
-		err := s.gateway.Send(curHolder, txt)
+		defer s.notifying.Done()
+		s.notifyWhenPresent(holder)
+	}()
+}
+
+//notifyWhenPresent notifies the holder, skips them or waits for them to come back according to the presence policy
+func (s *service) notifyWhenPresent(holder string) {
+	absence := s.absence(holder)
+	if absence == "" {
+		s.notifyHolder(holder)
+		return
+	}
+	if s.presencePolicy == usecase.SkipAbsent && s.skipAbsentHolder(holder, absence) {
+		return
+	}
+	s.waitForHolderToComeBack(holder, absence)
+}
+
+//Resume doesn't start the ack deadline of a notified holder, the outbox starts it when it delivers the notification
+func (s *service) Resume() error {
+	queue, err := s.Show()
+	if err != nil {
+		return err
+	}
+	holder := queue.CurHolder()
+	if holder == "" || !queue.HolderIsSleeping {
+		return nil
+	}
+	if !queue.AckDeadlineTs.IsZero() {
+		log.Printf("resume the ack deadline of %s at %s", holder, queue.AckDeadlineTs)
+		s.clock.AfterFunc(queue.AckDeadlineTs.Sub(s.clock.Now()), func() { s.passAtAckDeadline(holder) })
+		return nil
+	}
+	if !queue.HolderIsNotified {
+		log.Printf("resume notifying %s", holder)
+		s.goNotifyWhenPresent(holder)
+	}
+	return nil
+}
+
+//notifyHolder tells the holder their turn came, the ack deadline starts when the notification is delivered, see StartAckDeadline
+func (s *service) notifyHolder(holder string) {
+	s.setDeferral(holder, nil)
+	labels := s.localizer.Labels(holder)
+	wait := labels.Plural("minutes", int(math.Ceil(s.waitForAck.Minutes())), nil)
+	txt := labels.Format("your_turn_came", i18n.Params{"wait": wait})
+	s.gateway.Notify(holder, gateway.KindYourTurn, txt)
+	s.markNotified(holder)
+}
+
+func (s *service) markNotified(holder string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue, err := s.rep.Read()
+	if err != nil {
+		log.Printf("can't mark %s notified: %s", holder, err)
+		return
+	}
+	if queue.CurHolder() != holder || !queue.HolderIsSleeping {
+		return
+	}
+	queue.HolderIsNotified = true
+	if err := s.rep.Save(queue); err != nil {
+		log.Printf("can't mark %s notified: %s", holder, err)
+	}
+}
+
+//absence is why the user can't be notified now according to the presence policy, empty if they can
+func (s *service) absence(userId string) string {
+	if s.presencePolicy == "" || s.presencePolicy == usecase.NotifyAbsent {
+		return ""
+	}
+	absence, err := s.gateway.Absence(userId)
+	if err != nil {
+		log.Printf("can't get absence of %s, consider present: %s", userId, err)
+		return ""
+	}
+	return absence
+}
+
+//skipAbsentHolder passes the turn to the next one, unless the next one has been skipped already,
+//so absent users don't pass the turn to each other forever
+func (s *service) skipAbsentHolder(holder string, absence string) bool {
+	queue, err := s.Show()
+	if err != nil {
+		log.Printf("can't skip absent holder: %s", err)
+		return false
+	}
+	if len(queue.Entities) < 2 || queue.Deferrals[queue.Entities[1].UserId].Skipped {
+		return false
+	}
+	s.setDeferral(holder, &model.Deferral{Absence: absence, Skipped: true})
+	err = s.PassFromSleepingHolder(holder)
+	if err != nil {
+		log.Printf("can't skip absent holder: %s", err)
+		s.setDeferral(holder, nil)
+		return false
+	}
+	return true
+}
+
+//waitForHolderToComeBack notifies the holder when they are present
+func (s *service) waitForHolderToComeBack(holder string, absence string) {
+	s.setDeferral(holder, &model.Deferral{Absence: absence})
+	ticker := s.clock.NewTicker(presencePollInterval)
+	defer ticker.Stop()
+	for range ticker.C() {
+		queue, err := s.Show()
 		if err != nil {
-			log.Printf("can't send %s '%s' %s", curHolder, txt, err)
+			log.Printf("can't wait for holder: %s", err)
+			continue
+		}
+		if queue.CurHolder() != holder || !queue.HolderIsSleeping {
+			s.setDeferral(holder, nil)
 			return
 		}
-		time.AfterFunc(waitForAck, func() { s.passFromSleepingHolder(curHolder) })
-	}()
+		if s.absence(holder) == "" {
+			s.notifyHolder(holder)
+			return
+		}
+	}
+}
+
+//setDeferral sets or, if deferral is nil, clears deferral of the user
+func (s *service) setDeferral(userId string, deferral *model.Deferral) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue, err := s.rep.Read()
+	if err != nil {
+		log.Printf("can't set deferral of %s: %s", userId, err)
+		return
+	}
+	_, deferred := queue.Deferrals[userId]
+	if deferral == nil && !deferred {
+		return
+	}
+	deferrals := map[string]model.Deferral{}
+	for id, d := range queue.Deferrals {
+		if id != userId && queue.IndexOf(id) != -1 {
+			deferrals[id] = d
+		}
+	}
+	if deferral != nil {
+		deferrals[userId] = *deferral
+	}
+	queue.Deferrals = deferrals
+	if err := s.rep.Save(queue); err != nil {
+		log.Printf("can't set deferral of %s: %s", userId, err)
+	}
+}
+
+//passAtAckDeadline passes the turn unless the holder has got another turn since the deadline was started
+func (s *service) passAtAckDeadline(holder string) {
+	queue, err := s.Show()
+	if err != nil {
+		log.Printf("can't pass at ack deadline %s", err)
+		return
+	}
+	if queue.AckDeadlineTs.IsZero() || queue.AckDeadlineTs.After(s.clock.Now()) {
+		log.Printf("ack deadline of %s has moved, don't pass", holder)
+		return
+	}
+	s.passFromSleepingHolder(holder)
 }
 
 func (s *service) passFromSleepingHolder(holderUserId string) {
@@ -45,12 +207,12 @@ func (s *service) passFromSleepingHolder(holderUserId string) {
 		return
 	}
 	if err == usecase.NoOneToPass {
-		s.gateway.SendAndLog(holderUserId, "Я бы передал твой ход следующему, пока ты спишь, но ты один в очереди")
+		s.gateway.SendAndLog(holderUserId, s.localizer.Labels(holderUserId).MustGet("no_one_to_pass_while_sleeping"))
 		return
 	}
 	if err != nil {
 		log.Printf("can't passFromSleepingHolder %s", err)
 		return
 	}
-	s.gateway.SendAndLog(holderUserId, "Твой ход передался следующему, пока ты спал")
+	s.gateway.Notify(holderUserId, gateway.KindPassed, s.localizer.Labels(holderUserId).MustGet("passed_while_sleeping"))
 }
@@ -0,0 +1,239 @@
+package impl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	eventmock "github.com/yonesko/slack-queue-bot/event/mock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	queuemock "github.com/yonesko/slack-queue-bot/queue/mock"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"sync"
+	"testing"
+	"time"
+)
+
+//presenceGateway lets tests bring users back while the service polls their presence
+type presenceGateway struct {
+	gateway.Mock
+	mu       sync.Mutex
+	absences map[string]string
+	notified []string
+}
+
+func (g *presenceGateway) Notify(userId string, kind gateway.Kind, txt string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.notified = append(g.notified, userId+": "+string(kind))
+}
+
+func (g *presenceGateway) gotTurn(userId string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, n := range g.notified {
+		if n == userId+": "+string(gateway.KindYourTurn) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *presenceGateway) Absence(userId string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.absences[userId], nil
+}
+
+func (g *presenceGateway) comeBack(userId string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.absences, userId)
+}
+
+func buildServiceWithPresence(queue model.Queue, g gateway.Gateway, policy usecase.PresencePolicy) *service {
+	return &service{&queuemock.QueueRepository{Queue: queue}, &eventmock.QueueChangedEventBus{Inbox: []interface{}{}},
+		sync.Mutex{}, g, preference.NewLocalizerMock(), time.Minute * 7, policy, clock.NewFake(time.Now()), sync.WaitGroup{}}
+}
+
+func TestNotifyNewHolder_skip_absent_holder(t *testing.T) {
+	i18n.TestInit()
+	g := &presenceGateway{absences: map[string]string{"1": gateway.AbsenceDnd}}
+	s := buildServiceWithPresence(model.Queue{Entities: []model.QueueEntity{{"1"}, {"2"}}}, g, usecase.SkipAbsent)
+
+	s.notifyNewHolderAndWaitForAck(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	s.notifying.Wait()
+
+	queue, err := s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, []model.QueueEntity{{"2"}, {"1"}}, queue.Entities)
+	assert.Equal(t, model.Deferral{Absence: gateway.AbsenceDnd, Skipped: true}, queue.Deferrals["1"])
+	var timedOut model.HolderTimedOutEvent
+	for _, e := range s.bus.(*eventmock.QueueChangedEventBus).Inbox {
+		if ev, ok := e.(model.HolderTimedOutEvent); ok {
+			timedOut = ev
+		}
+	}
+	assert.Equal(t, "2", timedOut.NewHolderUserId)
+	assert.Equal(t, gateway.AbsenceDnd, timedOut.Absence, "a skipped holder didn't time out by the ack deadline")
+}
+
+func TestNotifyNewHolder_absent_users_dont_skip_each_other(t *testing.T) {
+	i18n.TestInit()
+	g := &presenceGateway{absences: map[string]string{"1": gateway.AbsenceAway, "2": gateway.AbsenceAway}}
+	s := buildServiceWithPresence(model.Queue{
+		Entities:  []model.QueueEntity{{"1"}, {"2"}},
+		Deferrals: map[string]model.Deferral{"2": {Absence: gateway.AbsenceAway, Skipped: true}},
+	}, g, usecase.SkipAbsent)
+	fake := s.clock.(*clock.Fake)
+
+	s.notifyNewHolderAndWaitForAck(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	assert.Eventually(t, func() bool { return fake.Timers() == 1 }, time.Second, time.Millisecond, "presence is polled")
+
+	queue, err := s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", queue.CurHolder())
+	assert.Equal(t, model.Deferral{Absence: gateway.AbsenceAway}, queue.Deferrals["1"])
+
+	g.comeBack("1")
+	fake.Advance(presencePollInterval)
+	s.notifying.Wait()
+}
+
+func TestNotifyNewHolder_wait_for_absent_holder(t *testing.T) {
+	i18n.TestInit()
+	g := &presenceGateway{absences: map[string]string{"1": gateway.AbsenceAway}}
+	s := buildServiceWithPresence(model.Queue{Entities: []model.QueueEntity{{"1"}, {"2"}}}, g, usecase.WaitForAbsent)
+	fake := s.clock.(*clock.Fake)
+
+	s.notifyNewHolderAndWaitForAck(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	assert.Eventually(t, func() bool { return fake.Timers() == 1 }, time.Second, time.Millisecond, "presence is polled")
+	fake.Advance(presencePollInterval)
+	queue, err := s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", queue.CurHolder())
+	assert.Equal(t, model.Deferral{Absence: gateway.AbsenceAway}, queue.Deferrals["1"])
+
+	g.comeBack("1")
+	fake.Advance(presencePollInterval)
+	assert.Eventually(t, func() bool {
+		queue, err := s.Show()
+		return err == nil && len(queue.Deferrals) == 0
+	}, time.Second, time.Millisecond)
+	queue, err = s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", queue.CurHolder())
+	s.notifying.Wait()
+	assert.True(t, g.gotTurn("1"), "the holder is notified when they come back")
+	assert.Equal(t, 0, fake.Timers(), "polling stops")
+}
+
+func TestNotifyNewHolder_ack_timeout(t *testing.T) {
+	i18n.TestInit()
+	g := &presenceGateway{}
+	s := buildServiceWithPresence(model.Queue{Entities: []model.QueueEntity{{"1"}, {"2"}}}, g, usecase.NotifyAbsent)
+	fake := s.clock.(*clock.Fake)
+
+	s.notifyNewHolderAndWaitForAck(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	s.notifying.Wait()
+	assert.True(t, g.gotTurn("1"))
+	assert.Equal(t, 0, fake.Timers(), "the ack deadline waits for the notification to be delivered")
+	fake.Advance(time.Second)
+	assert.Nil(t, s.StartAckDeadline("1"))
+	assert.Equal(t, 1, fake.Timers(), "the ack deadline starts")
+	assert.Nil(t, s.StartAckDeadline("1"), "a redelivery doesn't move the deadline")
+	queue, err := s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, fake.Now().Add(s.waitForAck), queue.AckDeadlineTs)
+	fake.Advance(s.waitForAck - time.Second)
+	queue, err = s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", queue.CurHolder(), "the holder has time to ack")
+
+	fake.Advance(time.Second)
+	queue, err = s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, []model.QueueEntity{{"2"}, {"1"}}, queue.Entities, "the turn is passed when the holder doesn't ack")
+	s.notifying.Wait()
+}
+
+func TestNotifyNewHolder_acked_in_time(t *testing.T) {
+	i18n.TestInit()
+	g := &presenceGateway{}
+	s := buildServiceWithPresence(model.Queue{Entities: []model.QueueEntity{{"1"}, {"2"}}}, g, usecase.NotifyAbsent)
+	fake := s.clock.(*clock.Fake)
+
+	s.notifyNewHolderAndWaitForAck(model.NewHolderEvent{CurrentHolderUserId: "1"})
+	s.notifying.Wait()
+	assert.True(t, g.gotTurn("1"))
+	assert.Nil(t, s.StartAckDeadline("1"))
+	assert.Nil(t, s.Ack("1"))
+	fake.Advance(s.waitForAck)
+	queue, err := s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", queue.CurHolder())
+	assert.Equal(t, fake.Now().Add(-s.waitForAck), queue.HoldTs, "hold time counts from the turn, not from the ack")
+}
+
+func TestNotifyNewHolder_stale_ack_deadline(t *testing.T) {
+	i18n.TestInit()
+	s := buildServiceWithPresence(model.Queue{Entities: []model.QueueEntity{{"1"}, {"2"}}}, &presenceGateway{}, usecase.NotifyAbsent)
+	fake := s.clock.(*clock.Fake)
+	assert.Nil(t, s.UpdateOnNewHolder())
+	assert.Nil(t, s.StartAckDeadline("1"))
+
+	fake.Advance(time.Minute)
+	assert.Nil(t, s.UpdateOnNewHolder(), "the holder gets the turn again")
+	assert.Nil(t, s.StartAckDeadline("1"))
+	fake.Advance(s.waitForAck - time.Minute)
+	queue, err := s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", queue.CurHolder(), "the deadline of the previous turn doesn't pass the turn")
+
+	fake.Advance(time.Minute)
+	queue, err = s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "2", queue.CurHolder())
+	assert.Equal(t, usecase.YouAreNotHolder, s.StartAckDeadline("1"))
+	s.notifying.Wait()
+}
+
+func TestService_Resume(t *testing.T) {
+	i18n.TestInit()
+	g := &presenceGateway{}
+	s := buildServiceWithPresence(model.Queue{Entities: []model.QueueEntity{{"1"}, {"2"}}, HolderIsSleeping: true}, g, usecase.NotifyAbsent)
+	assert.Nil(t, s.Resume())
+	s.notifying.Wait()
+	assert.True(t, g.gotTurn("1"), "the holder popped before the restart is notified")
+	queue, err := s.Show()
+	assert.Nil(t, err)
+	assert.True(t, queue.HolderIsNotified)
+
+	g = &presenceGateway{}
+	s = buildServiceWithPresence(model.Queue{Entities: []model.QueueEntity{{"1"}, {"2"}}, HolderIsSleeping: true, HolderIsNotified: true}, g, usecase.NotifyAbsent)
+	fake := s.clock.(*clock.Fake)
+	assert.Nil(t, s.Resume())
+	s.notifying.Wait()
+	assert.False(t, g.gotTurn("1"), "a notified holder isn't notified twice")
+	assert.Equal(t, 0, fake.Timers(), "the deadline waits for the notification to be delivered")
+
+	fake = clock.NewFake(time.Now())
+	s = buildServiceWithPresence(model.Queue{
+		Entities:         []model.QueueEntity{{"1"}, {"2"}},
+		HolderIsSleeping: true,
+		HolderIsNotified: true,
+		AckDeadlineTs:    fake.Now().Add(time.Minute),
+	}, &presenceGateway{}, usecase.NotifyAbsent)
+	s.clock = fake
+	assert.Nil(t, s.Resume())
+	fake.Advance(time.Minute - time.Second)
+	queue, err = s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", queue.CurHolder())
+	fake.Advance(time.Second)
+	queue, err = s.Show()
+	assert.Nil(t, err)
+	assert.Equal(t, "2", queue.CurHolder(), "the ack deadline goes on after the restart")
+	s.notifying.Wait()
+}
@@ -2,10 +2,12 @@ package impl
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
 	eventmock "github.com/yonesko/slack-queue-bot/event/mock"
 	"github.com/yonesko/slack-queue-bot/gateway"
 	"github.com/yonesko/slack-queue-bot/i18n"
 	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
 	queuemock "github.com/yonesko/slack-queue-bot/queue/mock"
 	"github.com/yonesko/slack-queue-bot/usecase"
 	"sync"
@@ -17,12 +19,11 @@ func TestNewHolderEventAddToEmptyQueue(t *testing.T) {
 	i18n.TestInit()
 	bus, service := buildQueueServiceAndBus(model.Queue{})
 	err := service.Add(model.QueueEntity{UserId: "123"})
-	time.Sleep(time.Millisecond)
 	assert.Nil(t, err)
-	assert.Len(t, bus.Inbox, 1)
-	assert.Equal(t, "123", bus.Inbox[0].(model.NewHolderEvent).CurrentHolderUserId)
-	assert.Equal(t, "", bus.Inbox[0].(model.NewHolderEvent).PrevHolderUserId)
-	assert.Equal(t, "123", bus.Inbox[0].(model.NewHolderEvent).AuthorUserId)
+	assert.Len(t, derivedEvents(bus.Inbox), 1)
+	assert.Equal(t, "123", derivedEvents(bus.Inbox)[0].(model.NewHolderEvent).CurrentHolderUserId)
+	assert.Equal(t, "", derivedEvents(bus.Inbox)[0].(model.NewHolderEvent).PrevHolderUserId)
+	assert.Equal(t, "123", derivedEvents(bus.Inbox)[0].(model.NewHolderEvent).AuthorUserId)
 }
 
 //noinspection GoUnhandledErrorResult
@@ -34,7 +35,6 @@ func Test_NewHolderEvent_TheSecond_HolderRemoved(t *testing.T) {
 
 	err := service.DeleteById("123", "123")
 	assert.Nil(t, err)
-	time.Sleep(time.Millisecond)
 	assert.Contains(t, bus.Inbox, model.NewSecondEvent{CurrentSecondUserId: "z"})
 }
 
@@ -44,7 +44,6 @@ func Test_NewHolderEvent_TheSecond_SecondRemoved(t *testing.T) {
 	bus, service := buildQueueServiceAndBus(model.Queue{Entities: []model.QueueEntity{{"123"}, {"abc"}, {"z"}}})
 
 	err := service.DeleteById("abc", "123")
-	time.Sleep(time.Millisecond * 10)
 	assert.Nil(t, err)
 	assert.Contains(t, bus.Inbox, model.NewSecondEvent{CurrentSecondUserId: "z"})
 }
@@ -55,12 +54,11 @@ func TestNewHolderEventSelfDeleteHolder(t *testing.T) {
 	bus, service := buildQueueServiceAndBus(model.Queue{Entities: []model.QueueEntity{{"123"}, {"abc"}}})
 
 	err := service.DeleteById("123", "123")
-	time.Sleep(time.Millisecond * 10)
 	assert.Nil(t, err)
-	assert.Len(t, bus.Inbox, 1)
-	assert.Equal(t, "abc", bus.Inbox[0].(model.NewHolderEvent).CurrentHolderUserId)
-	assert.Equal(t, "123", bus.Inbox[0].(model.NewHolderEvent).PrevHolderUserId)
-	assert.Equal(t, "123", bus.Inbox[0].(model.NewHolderEvent).AuthorUserId)
+	assert.Len(t, derivedEvents(bus.Inbox), 1)
+	assert.Equal(t, "abc", derivedEvents(bus.Inbox)[0].(model.NewHolderEvent).CurrentHolderUserId)
+	assert.Equal(t, "123", derivedEvents(bus.Inbox)[0].(model.NewHolderEvent).PrevHolderUserId)
+	assert.Equal(t, "123", derivedEvents(bus.Inbox)[0].(model.NewHolderEvent).AuthorUserId)
 }
 
 //noinspection GoUnhandledErrorResult
@@ -69,18 +67,17 @@ func TestNewHolderEventForceDeleteHolder(t *testing.T) {
 	bus, service := buildQueueServiceAndBus(model.Queue{Entities: []model.QueueEntity{{"123"}, {"abc"}, {"z"}}})
 
 	assert.Nil(t, service.DeleteById("123", "jhgfdvxc"))
-	time.Sleep(time.Millisecond * 10)
 	assert.True(t, containsNewHolderEvent(bus.Inbox, "abc", "jhgfdvxc", "123"))
 }
 
 func TestNewHolderEventSelfDeleteNotHolder(t *testing.T) {
 	bus := eventmock.QueueChangedEventBus{Inbox: []interface{}{}}
 	queueRepository := queuemock.QueueRepository{model.Queue{Entities: []model.QueueEntity{{"123"}, {"abc"}}}}
-	service := &service{&queueRepository, &bus, sync.Mutex{}, nil}
+	service := &service{&queueRepository, &bus, sync.Mutex{}, nil, preference.NewLocalizerMock(), time.Minute * 7, usecase.NotifyAbsent, clock.NewFake(time.Now()), sync.WaitGroup{}}
 
 	err := service.DeleteById("abc", "abc")
 	assert.Nil(t, err)
-	assert.Empty(t, bus.Inbox)
+	assert.Empty(t, derivedEvents(bus.Inbox))
 }
 
 //noinspection GoUnhandledErrorResult
@@ -88,19 +85,17 @@ func Test_Pass_emits_events(t *testing.T) {
 	i18n.TestInit()
 	bus, service := buildQueueServiceAndBus(model.Queue{Entities: []model.QueueEntity{{"123"}}})
 	service.Pass("123")
-	assert.Empty(t, bus.Inbox)
+	assert.Empty(t, derivedEvents(bus.Inbox))
 	//
 	service.Add(model.QueueEntity{UserId: "a"})
 	service.Pass("123")
 	assert.Contains(t, bus.Inbox, model.NewSecondEvent{CurrentSecondUserId: "123"})
-	time.Sleep(time.Millisecond * 5)
 	assert.True(t, containsNewHolderEvent(bus.Inbox, "a", "123", "123"))
 	//
 	bus.Inbox = nil
 	service.Add(model.QueueEntity{UserId: "b"})
 	service.Add(model.QueueEntity{UserId: "c"})
-	time.Sleep(time.Millisecond * 5)
-	assert.Empty(t, bus.Inbox)
+	assert.Empty(t, derivedEvents(bus.Inbox))
 }
 
 func Test_delete_all_emits_DeletedEvent(t *testing.T) {
@@ -145,7 +140,6 @@ func TestNewHolderEventPopAnotherUser(t *testing.T) {
 	bus, service := buildQueueServiceAndBus(model.Queue{Entities: []model.QueueEntity{{"123"}, {"abc"}}})
 
 	_, err := service.Pop("abc")
-	time.Sleep(time.Millisecond * 10)
 	assert.Nil(t, err)
 	containsNewHolderEvent(bus.Inbox, "abc", "abc", "123")
 }
@@ -153,11 +147,11 @@ func TestNewHolderEventPopAnotherUser(t *testing.T) {
 func TestNewHolderEventPopOnEmpty(t *testing.T) {
 	bus := eventmock.QueueChangedEventBus{Inbox: []interface{}{}}
 	queueRepository := queuemock.QueueRepository{model.Queue{}}
-	service := &service{&queueRepository, &bus, sync.Mutex{}, nil}
+	service := &service{&queueRepository, &bus, sync.Mutex{}, nil, preference.NewLocalizerMock(), time.Minute * 7, usecase.NotifyAbsent, clock.NewFake(time.Now()), sync.WaitGroup{}}
 
 	_, err := service.Pop("123")
 	assert.Equal(t, usecase.QueueIsEmpty, err)
-	assert.Empty(t, bus.Inbox)
+	assert.Empty(t, derivedEvents(bus.Inbox))
 }
 
 func Test_NewHolderEvent_CheckForEvents_on_PassFromSleepingHolder(t *testing.T) {
@@ -165,13 +159,12 @@ func Test_NewHolderEvent_CheckForEvents_on_PassFromSleepingHolder(t *testing.T)
 	bus, service := buildQueueServiceAndBus(model.Queue{})
 
 	assert.Equal(t, usecase.HolderIsNotSleeping, service.PassFromSleepingHolder("5653"))
-	assert.Empty(t, bus.Inbox)
+	assert.Empty(t, derivedEvents(bus.Inbox))
 	assert.Nil(t, service.Add(model.QueueEntity{UserId: "4"}))
 	assert.Equal(t, usecase.NoOneToPass, service.PassFromSleepingHolder("4"))
 	assert.Nil(t, service.Add(model.QueueEntity{UserId: "6"}))
 	assert.Nil(t, service.PassFromSleepingHolder("4"))
 	//6 4
-	time.Sleep(time.Millisecond * 5)
 	containsNewHolderEvent(bus.Inbox, "6", "4", "4")
 	assert.Contains(t, bus.Inbox, model.NewSecondEvent{CurrentSecondUserId: "4"})
 	assert.Nil(t, service.Add(model.QueueEntity{UserId: "1"}))
@@ -180,7 +173,6 @@ func Test_NewHolderEvent_CheckForEvents_on_PassFromSleepingHolder(t *testing.T)
 	assert.Equal(t, usecase.YouAreNotHolder, service.PassFromSleepingHolder("4"))
 	assert.Nil(t, service.PassFromSleepingHolder("6"))
 	//4 6 1 17
-	time.Sleep(time.Millisecond * 5)
 	containsNewHolderEvent(bus.Inbox, "4", "6", "6")
 	assert.Contains(t, bus.Inbox, model.NewSecondEvent{CurrentSecondUserId: "6"})
 }
@@ -188,10 +180,23 @@ func Test_NewHolderEvent_CheckForEvents_on_PassFromSleepingHolder(t *testing.T)
 func buildQueueServiceAndBus(queue model.Queue) (*eventmock.QueueChangedEventBus, *service) {
 	bus := eventmock.QueueChangedEventBus{Inbox: []interface{}{}}
 	queueRepository := queuemock.QueueRepository{queue}
-	service := &service{&queueRepository, &bus, sync.Mutex{}, gateway.Mock{}}
+	service := &service{&queueRepository, &bus, sync.Mutex{}, gateway.Mock{}, preference.NewLocalizerMock(), time.Minute * 7, usecase.NotifyAbsent, clock.NewFake(time.Now()), sync.WaitGroup{}}
 	return &bus, service
 }
 
+//derivedEvents filters out position changes, which accompany most other events, and events of operations
+func derivedEvents(inbox []interface{}) []interface{} {
+	var events []interface{}
+	for _, e := range inbox {
+		switch e.(type) {
+		case model.PositionChangedEvent, model.OperationEvent:
+		default:
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
 func containsNewHolderEvent(inbox []interface{}, cur, au, prev string) bool {
 	for _, e := range inbox {
 		if event, ok := e.(model.NewHolderEvent); ok {
@@ -202,3 +207,108 @@ func containsNewHolderEvent(inbox []interface{}, cur, au, prev string) bool {
 	}
 	return false
 }
+
+func TestNewHolderEvent_last_holder_leaves(t *testing.T) {
+	i18n.TestInit()
+	bus, service := buildQueueServiceAndBus(model.Queue{Entities: []model.QueueEntity{{"123"}}})
+
+	assert.Nil(t, service.DeleteById("123", "123"))
+	assert.True(t, containsNewHolderEvent(bus.Inbox, "", "123", "123"))
+	queue, err := service.Show()
+	assert.Nil(t, err)
+	assert.True(t, queue.HoldTs.IsZero())
+}
+
+func TestPositionChangedEvent(t *testing.T) {
+	i18n.TestInit()
+	bus, service := buildQueueServiceAndBus(model.Queue{Entities: []model.QueueEntity{{"1"}, {"2"}, {"3"}}})
+
+	assert.Nil(t, service.Pass("2"))
+	assert.Contains(t, bus.Inbox, model.PositionChangedEvent{
+		AuthorUserId: "2",
+		Changes:      []model.PositionChange{{"1", 0, 0}, {"3", 2, 1}, {"2", 1, 2}},
+		Ts:           bus.Inbox[len(bus.Inbox)-1].(model.PositionChangedEvent).Ts,
+	})
+
+	bus.Inbox = nil
+	assert.Nil(t, service.DeleteById("1", "1"))
+	var event model.PositionChangedEvent
+	for _, e := range bus.Inbox {
+		if ev, ok := e.(model.PositionChangedEvent); ok {
+			event = ev
+		}
+	}
+	assert.Equal(t, []model.PositionChange{{"3", 1, 0}, {"2", 2, 1}, {"1", 0, -1}}, event.Changes)
+	assert.False(t, event.HoldTs.IsZero(), "hold ts of the new holder")
+}
+
+//operationEvents are events of operations in order of sending, their timestamps are zeroed
+func operationEvents(inbox []interface{}) []interface{} {
+	var events []interface{}
+	for _, e := range inbox {
+		if _, ok := e.(model.OperationEvent); ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestOperationEvents(t *testing.T) {
+	i18n.TestInit()
+	bus, service := buildQueueServiceAndBus(model.Queue{})
+	fake := service.clock.(*clock.Fake)
+	start := fake.Now()
+	//every operation is a minute after the previous one
+	at := func(minute int) time.Time { return start.Add(time.Minute * time.Duration(minute)) }
+
+	assert.Nil(t, service.Add(model.QueueEntity{UserId: "1"}))
+	fake.Advance(time.Minute)
+	assert.Nil(t, service.Add(model.QueueEntity{UserId: "2"}))
+	fake.Advance(time.Minute)
+	assert.Nil(t, service.Ack("1"))
+	fake.Advance(time.Minute)
+	assert.Nil(t, service.Add(model.QueueEntity{UserId: "3"}))
+	fake.Advance(time.Minute)
+	assert.Nil(t, service.Pass("2"))
+	assert.Equal(t, []interface{}{
+		model.AddedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "1", Queue: []string{"1"}, Positions: []model.PositionChange{{"1", -1, 0}}, Ts: at(0)}, UserId: "1"},
+		model.AddedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "2", Queue: []string{"1", "2"}, Positions: []model.PositionChange{{"1", 0, 0}, {"2", -1, 1}}, Ts: at(1)}, UserId: "2"},
+		model.AckedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "1", Queue: []string{"1", "2"}, Positions: []model.PositionChange{{"1", 0, 0}, {"2", 1, 1}}, Ts: at(2)}},
+		model.AddedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "3", Queue: []string{"1", "2", "3"}, Positions: []model.PositionChange{{"1", 0, 0}, {"2", 1, 1}, {"3", -1, 2}}, Ts: at(3)}, UserId: "3"},
+		model.PassedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "2", Queue: []string{"1", "3", "2"}, Positions: []model.PositionChange{{"1", 0, 0}, {"3", 2, 1}, {"2", 1, 2}}, Ts: at(4)}, ToUserId: "3"},
+	}, operationEvents(bus.Inbox))
+
+	bus.Inbox = nil
+	fake.Advance(time.Minute)
+	assert.Nil(t, service.DeleteById("1", "1"))
+	fake.Advance(time.Minute)
+	assert.Nil(t, service.PassFromSleepingHolder("3"))
+	fake.Advance(time.Minute)
+	_, err := service.Pop("5")
+	assert.Nil(t, err)
+	fake.Advance(time.Minute)
+	assert.Nil(t, service.Add(model.QueueEntity{UserId: "4"}))
+	fake.Advance(time.Minute)
+	_, err = service.Release("", "success")
+	assert.Nil(t, err)
+	fake.Advance(time.Minute)
+	assert.Nil(t, service.DeleteAll("5"))
+	assert.Equal(t, []interface{}{
+		model.HolderTimedOutEvent{QueueOperation: model.QueueOperation{AuthorUserId: "3", Queue: []string{"2", "3"}, Positions: []model.PositionChange{{"2", 1, 0}, {"3", 0, 1}}, Ts: at(6)}, NewHolderUserId: "2"},
+		model.PoppedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "5", Queue: []string{"3"}, Positions: []model.PositionChange{{"3", 1, 0}, {"2", 0, -1}}, Ts: at(7)}, PoppedUserId: "2"},
+		model.AddedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "4", Queue: []string{"3", "4"}, Positions: []model.PositionChange{{"3", 0, 0}, {"4", -1, 1}}, Ts: at(8)}, UserId: "4"},
+		model.ReleasedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "3", Queue: []string{"4"}, Positions: []model.PositionChange{{"4", 1, 0}, {"3", 0, -1}}, Ts: at(9)}, ReleasedUserId: "3", Outcome: "success"},
+		model.CleanedEvent{QueueOperation: model.QueueOperation{AuthorUserId: "5", Queue: []string{}, Positions: []model.PositionChange{{"4", 0, -1}}, Ts: at(10)}},
+	}, operationEvents(bus.Inbox), "deleting isn't an operation of its own, DeletedEvent tells about it")
+}
+
+func TestOperationEvents_precede_derived_ones(t *testing.T) {
+	i18n.TestInit()
+	bus, service := buildQueueServiceAndBus(model.Queue{})
+
+	assert.Nil(t, service.Add(model.QueueEntity{UserId: "1"}))
+	_, added := bus.Inbox[0].(model.AddedEvent)
+	assert.True(t, added, "%#v", bus.Inbox)
+	_, newHolder := bus.Inbox[1].(model.NewHolderEvent)
+	assert.True(t, newHolder, "%#v", bus.Inbox)
+}
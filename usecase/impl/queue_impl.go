@@ -2,9 +2,11 @@ package impl
 
 import (
 	"fmt"
+	"github.com/yonesko/slack-queue-bot/clock"
 	"github.com/yonesko/slack-queue-bot/event"
 	"github.com/yonesko/slack-queue-bot/gateway"
 	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
 	"github.com/yonesko/slack-queue-bot/queue"
 	"github.com/yonesko/slack-queue-bot/usecase"
 	"sync"
@@ -12,17 +14,24 @@ import (
 )
 
 type service struct {
-	rep     queue.Repository
-	bus     event.QueueChangedEventBus
-	mu      sync.Mutex
-	gateway gateway.Gateway
+	rep        queue.Repository
+	bus        event.QueueChangedEventBus
+	mu         sync.Mutex
+	gateway    gateway.Gateway
+	localizer  preference.Localizer
+	waitForAck time.Duration
+	//presencePolicy tells what to do with a new holder who is absent
+	presencePolicy usecase.PresencePolicy
+	clock          clock.Clock
+	//notifying are goroutines notifying holders, tests wait for them to end
+	notifying sync.WaitGroup
 }
 
-func NewQueueService(repository queue.Repository, queueChangedEventBus event.QueueChangedEventBus, gateway gateway.Gateway) usecase.QueueService {
+func NewQueueService(repository queue.Repository, queueChangedEventBus event.QueueChangedEventBus, gateway gateway.Gateway, localizer preference.Localizer, waitForAck time.Duration, presencePolicy usecase.PresencePolicy, clock clock.Clock) usecase.QueueService {
 	if _, err := repository.Read(); err != nil {
 		panic(fmt.Sprintf("can't crete QueueService: %s", err))
 	}
-	return &service{repository, queueChangedEventBus, sync.Mutex{}, gateway}
+	return &service{repository, queueChangedEventBus, sync.Mutex{}, gateway, localizer, waitForAck, presencePolicy, clock, sync.WaitGroup{}}
 }
 
 func (s *service) Pass(authorUserId string) error {
@@ -48,11 +57,13 @@ func (s *service) Pass(authorUserId string) error {
 	if nexti >= len(queue.Entities) {
 		return usecase.NoOneToPass
 	}
+	before := queue.Copy()
 	queue.Entities[i], queue.Entities[nexti] = queue.Entities[nexti], queue.Entities[i]
 	err = s.rep.Save(queue)
 	if err != nil {
 		return err
 	}
+	s.bus.Send(model.PassedEvent{QueueOperation: s.operation(authorUserId, before, queue), ToUserId: queue.Entities[i].UserId})
 	return nil
 }
 
@@ -66,11 +77,14 @@ func (s *service) Pop(authorUserId string) (string, error) {
 	if len(queue.Entities) == 0 {
 		return "", usecase.QueueIsEmpty
 	}
-	err = s.deleteById(queue.Entities[0].UserId, authorUserId)
+	holder := queue.CurHolder()
+	err = s.deleteById(holder, authorUserId, func(before, after model.Queue) {
+		s.bus.Send(model.PoppedEvent{QueueOperation: s.operation(authorUserId, before, after), PoppedUserId: holder})
+	})
 	if err != nil {
 		return "", err
 	}
-	return queue.Entities[0].UserId, nil
+	return holder, nil
 }
 
 func (s *service) Add(entity model.QueueEntity) error {
@@ -90,23 +104,44 @@ func (s *service) Add(entity model.QueueEntity) error {
 	if i != -1 {
 		return usecase.AlreadyExistErr
 	}
+	before := queue.Copy()
 	queue.Entities = append(queue.Entities, entity)
 	err = s.rep.Save(queue)
 	if err != nil {
 		return err
 	}
+	s.bus.Send(model.AddedEvent{QueueOperation: s.operation(entity.UserId, before, queue), UserId: entity.UserId})
 	return nil
 }
 
 func (s *service) DeleteById(toDelUserId string, authorUserId string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.deleteById(toDelUserId, authorUserId)
+	return s.deleteById(toDelUserId, authorUserId, nil)
 
 }
 
-//lock must acquired in caller method
-func (s *service) deleteById(toDelUserId string, authorUserId string) error {
+func (s *service) Release(holderUserId string, outcome string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue, err := s.rep.Read()
+	if err != nil {
+		return "", err
+	}
+	holder := queue.CurHolder()
+	if holder == "" {
+		return "", usecase.QueueIsEmpty
+	}
+	if holderUserId != "" && holderUserId != holder {
+		return "", usecase.YouAreNotHolder
+	}
+	return holder, s.deleteById(holder, holder, func(before, after model.Queue) {
+		s.bus.Send(model.ReleasedEvent{QueueOperation: s.operation(holder, before, after), ReleasedUserId: holder, Outcome: outcome})
+	})
+}
+
+//lock must acquired in caller method, deleted is called before events of the change if not nil
+func (s *service) deleteById(toDelUserId string, authorUserId string, deleted func(before, after model.Queue)) error {
 	queue, err := s.rep.Read()
 	if err != nil {
 		return err
@@ -123,11 +158,15 @@ func (s *service) deleteById(toDelUserId string, authorUserId string) error {
 	if i == -1 {
 		return usecase.NoSuchUserErr
 	}
+	before := queue.Copy()
 	queue.Entities = append(queue.Entities[:i], queue.Entities[i+1:]...)
 	err = s.rep.Save(queue)
 	if err != nil {
 		return err
 	}
+	if deleted != nil {
+		deleted(before, queue)
+	}
 	return nil
 }
 
@@ -146,11 +185,13 @@ func (s *service) DeleteAll(authorUserId string) error {
 	if len(queue.Entities) == 0 {
 		return usecase.QueueIsEmpty
 	}
+	before := queue.Copy()
 	queue = model.Queue{}
 	err = s.rep.Save(queue)
 	if err != nil {
 		return err
 	}
+	s.bus.Send(model.CleanedEvent{QueueOperation: s.operation(authorUserId, before, queue)})
 	return nil
 }
 
@@ -171,13 +212,41 @@ func (s *service) UpdateOnNewHolder() error {
 		q.HoldTs = time.Time{}
 	} else {
 		q.HolderIsSleeping = true
-		q.HoldTs = time.Now()
+		q.HoldTs = s.clock.Now()
+	}
+	q.AckDeadlineTs = time.Time{}
+	q.HolderIsNotified = false
+
+	err = s.rep.Save(q)
+	if err != nil {
+		return err
 	}
+	return nil
+}
 
+//StartAckDeadline is called again when a notification is redelivered, the deadline doesn't move then
+func (s *service) StartAckDeadline(holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.rep.Read()
+	if err != nil {
+		return err
+	}
+	if q.CurHolder() != holder {
+		return usecase.YouAreNotHolder
+	}
+	if !q.HolderIsSleeping {
+		return usecase.HolderIsNotSleeping
+	}
+	if !q.AckDeadlineTs.IsZero() {
+		return nil
+	}
+	q.AckDeadlineTs = s.clock.Now().Add(s.waitForAck)
 	err = s.rep.Save(q)
 	if err != nil {
 		return err
 	}
+	s.clock.AfterFunc(s.waitForAck, func() { s.passAtAckDeadline(holder) })
 	return nil
 }
 
@@ -202,11 +271,17 @@ func (s *service) PassFromSleepingHolder(holder string) error {
 	if len(queue.Entities) < 2 {
 		return usecase.NoOneToPass
 	}
+	before := queue.Copy()
 	queue.Entities[0], queue.Entities[1] = queue.Entities[1], queue.Entities[0]
 	err = s.rep.Save(queue)
 	if err != nil {
 		return err
 	}
+	timedOut := model.HolderTimedOutEvent{QueueOperation: s.operation(holder, before, queue), NewHolderUserId: queue.CurHolder()}
+	if deferral := queue.Deferrals[holder]; deferral.Skipped {
+		timedOut.Absence = deferral.Absence
+	}
+	s.bus.Send(timedOut)
 	return nil
 }
 
@@ -223,11 +298,13 @@ func (s *service) Ack(authorUserId string) error {
 	if !q.HolderIsSleeping {
 		return usecase.HolderIsNotSleeping
 	}
+	before := q.Copy()
 	q.HolderIsSleeping = false
 	err = s.rep.Save(q)
 	if err != nil {
 		return err
 	}
+	s.bus.Send(model.AckedEvent{QueueOperation: s.operation(authorUserId, before, q)})
 	return nil
 }
 
@@ -235,6 +312,52 @@ func (s *service) emitEvents(authorUserId string, before model.Queue, after mode
 	s.emitNewHolderEvent(before, after, authorUserId)
 	s.emitNewSecondEvent(before, after)
 	s.emitDeletedEvent(before, after, authorUserId)
+	s.emitPositionChangedEvent(before, after, authorUserId)
+}
+
+//operation describes the change of the queue made by the author for events of operations
+func (s *service) operation(authorUserId string, before model.Queue, after model.Queue) model.QueueOperation {
+	positions, _ := positionChanges(before, after)
+	queue := make([]string, 0, len(after.Entities))
+	for _, e := range after.Entities {
+		queue = append(queue, e.UserId)
+	}
+	return model.QueueOperation{AuthorUserId: authorUserId, Queue: queue, Positions: positions, Ts: s.clock.Now()}
+}
+
+//positionChanges are positions of everyone in before and after, it tells if anyone's position has changed
+func positionChanges(before model.Queue, after model.Queue) ([]model.PositionChange, bool) {
+	beforeIndex, afterIndex := before.UserIdIndex(), after.UserIdIndex()
+	var changes []model.PositionChange
+	changed := false
+	for _, e := range after.Entities {
+		change := model.PositionChange{UserId: e.UserId, OldIndex: -1, NewIndex: afterIndex[e.UserId]}
+		if i, ok := beforeIndex[e.UserId]; ok {
+			change.OldIndex = i
+		}
+		changed = changed || change.Changed()
+		changes = append(changes, change)
+	}
+	for _, e := range before.Entities {
+		if _, ok := afterIndex[e.UserId]; !ok {
+			changes = append(changes, model.PositionChange{UserId: e.UserId, OldIndex: beforeIndex[e.UserId], NewIndex: -1})
+			changed = true
+		}
+	}
+	return changes, changed
+}
+
+func (s *service) emitPositionChangedEvent(before model.Queue, after model.Queue, authorUserId string) {
+	changes, changed := positionChanges(before, after)
+	if !changed {
+		return
+	}
+	//hold ts is updated after saving the queue when the holder changes
+	holdTs := after.HoldTs
+	if q, err := s.rep.Read(); err == nil {
+		holdTs = q.HoldTs
+	}
+	s.bus.Send(model.PositionChangedEvent{AuthorUserId: authorUserId, Changes: changes, HoldTs: holdTs, Ts: s.clock.Now()})
 }
 
 func (s *service) emitNewSecondEvent(before model.Queue, after model.Queue) {
@@ -256,17 +379,17 @@ func (s *service) emitNewHolderEvent(before model.Queue, after model.Queue, auth
 	}
 	if len(after.Entities) > 0 {
 		holderAfter = after.Entities[0].UserId
-
-		if holderBefore != holderAfter {
-			newHolderEvent := model.NewHolderEvent{
-				CurrentHolderUserId: holderAfter,
-				PrevHolderUserId:    holderBefore,
-				AuthorUserId:        authorUserId,
-				Ts:                  time.Now(),
-			}
-			go s.bus.Send(newHolderEvent)
-			s.notifyNewHolderAndWaitForAck(newHolderEvent)
+	}
+	//the holder has left the front of emptied queue when holderAfter is empty
+	if holderBefore != holderAfter {
+		newHolderEvent := model.NewHolderEvent{
+			CurrentHolderUserId: holderAfter,
+			PrevHolderUserId:    holderBefore,
+			AuthorUserId:        authorUserId,
+			Ts:                  s.clock.Now(),
 		}
+		s.bus.Send(newHolderEvent)
+		s.notifyNewHolderAndWaitForAck(newHolderEvent)
 	}
 }
 
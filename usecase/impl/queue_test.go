@@ -1,13 +1,14 @@
 package impl
 
 import (
-	"bou.ke/monkey"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
 	eventmock "github.com/yonesko/slack-queue-bot/event/mock"
 	"github.com/yonesko/slack-queue-bot/gateway"
 	"github.com/yonesko/slack-queue-bot/i18n"
 	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
 	"github.com/yonesko/slack-queue-bot/queue/mock"
 	"github.com/yonesko/slack-queue-bot/usecase"
 	"sync"
@@ -30,24 +31,22 @@ func TestService_Add_DifferentUsers(t *testing.T) {
 //noinspection GoUnhandledErrorResult
 func TestService_HoldTs(t *testing.T) {
 	i18n.TestInit()
-	now := time.Now()
-	patch := monkey.Patch(time.Now, func() time.Time { return now })
-	defer patch.Unpatch()
 	service := mockService()
+	fake := service.clock.(*clock.Fake)
+	now := fake.Now()
 	service.Add(model.QueueEntity{UserId: "123"})
-	time.Sleep(time.Millisecond * 5)
 	queue, _ := service.Show()
 	assert.Equal(t, now, queue.HoldTs)
+	fake.Advance(time.Minute)
 	service.Add(model.QueueEntity{UserId: "2"})
 	service.Add(model.QueueEntity{UserId: "3"})
-	assert.Equal(t, now, queue.HoldTs)
 	service.DeleteById("2", "2")
-	assert.Equal(t, now, queue.HoldTs)
-	now = time.Now().Add(time.Hour)
+	queue, _ = service.Show()
+	assert.Equal(t, now, queue.HoldTs, "hold ts changes with the holder only")
+	fake.Advance(time.Hour)
 	service.DeleteById("123", "123")
-	time.Sleep(time.Millisecond * 5)
 	queue, _ = service.Show()
-	assert.Equal(t, now.String(), queue.HoldTs.String())
+	assert.Equal(t, now.Add(time.Hour+time.Minute), queue.HoldTs)
 }
 
 func TestService_Pop(t *testing.T) {
@@ -64,6 +63,26 @@ func TestService_Pop(t *testing.T) {
 	equals(queue, []string{})
 }
 
+//noinspection GoUnhandledErrorResult
+func TestService_Release(t *testing.T) {
+	service := mockService()
+	_, err := service.Release("", "success")
+	assert.Equal(t, usecase.QueueIsEmpty, err)
+	service.Add(model.QueueEntity{UserId: "1"})
+	service.Add(model.QueueEntity{UserId: "2"})
+	service.Add(model.QueueEntity{UserId: "3"})
+	_, err = service.Release("2", "success")
+	assert.Equal(t, usecase.YouAreNotHolder, err)
+	released, err := service.Release("1", "success")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", released)
+	released, err = service.Release("", "failed")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", released)
+	queue, _ := service.Show()
+	assert.Equal(t, []model.QueueEntity{{UserId: "3"}}, queue.Entities)
+}
+
 func TestService_DeleteAll(t *testing.T) {
 	service := mockService()
 	err := service.DeleteAll("")
@@ -141,7 +160,6 @@ func addUsers(service usecase.QueueService, t *testing.T, start, end int, group
 func TestAck(t *testing.T) {
 	service := mockService()
 	service.Add(model.QueueEntity{UserId: "1"})
-	time.Sleep(time.Millisecond * 5)
 	queue, _ := service.Show()
 	assert.True(t, queue.HolderIsSleeping)
 	assert.Equal(t, usecase.YouAreNotHolder, service.Ack("5"))
@@ -158,11 +176,8 @@ func TestAck(t *testing.T) {
 }
 
 func TestService_UpdateNewHolder(t *testing.T) {
-	now := time.Now()
-	patch := monkey.Patch(time.Now, func() time.Time { return now })
-	defer patch.Unpatch()
-
 	service := mockService()
+	now := service.clock.Now()
 	assert.Nil(t, service.UpdateOnNewHolder())
 	queue, _ := service.Show()
 	assert.False(t, queue.HolderIsSleeping)
@@ -212,5 +227,10 @@ func mockService() *service {
 		&eventmock.QueueChangedEventBus{Inbox: []interface{}{}},
 		sync.Mutex{},
 		gateway.Mock{},
+		preference.NewLocalizerMock(),
+		time.Minute * 7,
+		usecase.NotifyAbsent,
+		clock.NewFake(time.Now()),
+		sync.WaitGroup{},
 	}
 }
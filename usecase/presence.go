@@ -0,0 +1,17 @@
+package usecase
+
+//PresencePolicy tells what to do with a user who is away or in DND when it's time to notify them
+type PresencePolicy string
+
+const (
+	//NotifyAbsent notifies regardless of presence
+	NotifyAbsent PresencePolicy = "notify"
+	//SkipAbsent passes the turn of an absent holder to the next one and doesn't warn an absent second
+	SkipAbsent PresencePolicy = "skip"
+	//WaitForAbsent notifies an absent holder and starts their ack deadline when they come back
+	WaitForAbsent PresencePolicy = "wait"
+)
+
+func (p PresencePolicy) IsValid() bool {
+	return p == NotifyAbsent || p == SkipAbsent || p == WaitForAbsent
+}
@@ -8,6 +8,9 @@ import (
 type QueueService interface {
 	Add(model.QueueEntity) error
 	DeleteById(toDelUserId string, authorUserId string) error
+	//Release deletes holderUserId if it holds the queue, or the current holder if holderUserId is empty,
+	//outcome of the pipeline is told in the event, returns the released holder
+	Release(holderUserId string, outcome string) (string, error)
 	Pop(authorUserId string) (string, error)
 	Ack(authorUserId string) error
 	PassFromSleepingHolder(holder string) error
@@ -15,6 +18,11 @@ type QueueService interface {
 	DeleteAll(authorUserId string) error
 	Show() (model.Queue, error)
 	UpdateOnNewHolder() error
+	//StartAckDeadline starts the time for the sleeping holder to ack once they have got their turn notification
+	StartAckDeadline(holder string) error
+	//Resume carries on with the sleeping holder after a restart: notifies them if they haven't been notified
+	//or waits for the ack deadline again
+	Resume() error
 }
 
 var (
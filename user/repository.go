@@ -3,6 +3,7 @@ package user
 import (
 	"github.com/nlopes/slack"
 	"github.com/yonesko/slack-queue-bot/model"
+	"sync"
 )
 
 type Repository interface {
@@ -18,7 +19,7 @@ func (r repository) FindById(id string) (model.User, error) {
 	if err != nil {
 		return model.User{}, nil
 	}
-	return model.User{Id: id, FullName: info.RealName, DisplayName: info.Name}, nil
+	return model.User{Id: id, FullName: info.RealName, DisplayName: info.Name, Locale: info.Locale, TZ: info.TZ}, nil
 }
 
 func NewRepository(slackApi *slack.Client) Repository {
@@ -27,10 +28,13 @@ func NewRepository(slackApi *slack.Client) Repository {
 
 type cachingRepository struct {
 	repository
+	mu   sync.Mutex
 	data map[string]model.User
 }
 
 func (r *cachingRepository) FindById(id string) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	user, ok := r.data[id]
 	if ok {
 		return user, nil
@@ -0,0 +1,187 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/outbox"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+//authorHeader names the Slack user on whose behalf the action is taken,
+//it is used as the author of emitted events
+const authorHeader = "X-Author-User-Id"
+
+//DeadLetters are messages the bot gave up sending
+type DeadLetters interface {
+	DeadLetters() ([]outbox.Message, error)
+}
+
+//EventFailures tells how many events every listener of the bus failed to handle
+type EventFailures interface {
+	Failures() map[string]int
+}
+
+//RejectedCommands tells how many commands of every user the rate limiter rejected
+type RejectedCommands interface {
+	Rejected() map[string]int
+}
+
+//AdminApi exposes QueueService as token-authenticated JSON endpoints
+type AdminApi struct {
+	queueService  usecase.QueueService
+	deadLetters   DeadLetters
+	eventFailures EventFailures
+	rejected      RejectedCommands
+	token         string
+	logger        *log.Logger
+}
+
+func NewAdminApi(lumberWriter io.Writer, queueService usecase.QueueService, deadLetters DeadLetters, eventFailures EventFailures, rejected RejectedCommands, token string) *AdminApi {
+	return &AdminApi{
+		queueService:  queueService,
+		deadLetters:   deadLetters,
+		eventFailures: eventFailures,
+		rejected:      rejected,
+		token:         token,
+		logger:        log.New(lumberWriter, "admin-api: ", log.Lshortfile|log.LstdFlags),
+	}
+}
+
+func (a *AdminApi) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/queue", a.auth(http.MethodGet, a.show))
+	mux.HandleFunc("/api/queue/add", a.auth(http.MethodPost, a.add))
+	mux.HandleFunc("/api/queue/entities/", a.auth(http.MethodDelete, a.delete))
+	mux.HandleFunc("/api/queue/pass", a.auth(http.MethodPost, a.pass))
+	mux.HandleFunc("/api/queue/pop", a.auth(http.MethodPost, a.pop))
+	mux.HandleFunc("/api/queue/ack", a.auth(http.MethodPost, a.ack))
+	mux.HandleFunc("/api/queue/clean", a.auth(http.MethodPost, a.clean))
+	mux.HandleFunc("/api/outbox/dead", a.auth(http.MethodGet, a.showDeadLetters))
+	mux.HandleFunc("/api/events/failures", a.auth(http.MethodGet, a.showEventFailures))
+	mux.HandleFunc("/api/commands/rejected", a.auth(http.MethodGet, a.showRejectedCommands))
+}
+
+type userRequest struct {
+	UserId string `json:"user_id"`
+}
+
+type popResponse struct {
+	DeletedUserId string `json:"deleted_user_id"`
+}
+
+func (a *AdminApi) auth(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, method, a.token) {
+			return
+		}
+		a.logger.Printf("%s %s by '%s'", r.Method, r.URL.Path, r.Header.Get(authorHeader))
+		handler(w, r)
+	}
+}
+
+func (a *AdminApi) show(w http.ResponseWriter, r *http.Request) {
+	a.writeQueue(w)
+}
+
+func (a *AdminApi) add(w http.ResponseWriter, r *http.Request) {
+	req, ok := a.readUserRequest(w, r)
+	if !ok {
+		return
+	}
+	a.writeResult(w, a.queueService.Add(model.QueueEntity{UserId: req.UserId}))
+}
+
+func (a *AdminApi) delete(w http.ResponseWriter, r *http.Request) {
+	userId := strings.TrimPrefix(r.URL.Path, "/api/queue/entities/")
+	if userId == "" {
+		writeJson(w, http.StatusBadRequest, errorResponse{"user id is required"})
+		return
+	}
+	a.writeResult(w, a.queueService.DeleteById(userId, r.Header.Get(authorHeader)))
+}
+
+func (a *AdminApi) pass(w http.ResponseWriter, r *http.Request) {
+	req, ok := a.readUserRequest(w, r)
+	if !ok {
+		return
+	}
+	a.writeResult(w, a.queueService.Pass(req.UserId))
+}
+
+func (a *AdminApi) pop(w http.ResponseWriter, r *http.Request) {
+	deletedUserId, err := a.queueService.Pop(r.Header.Get(authorHeader))
+	if err != nil {
+		writeErr(w, a.logger, err)
+		return
+	}
+	writeJson(w, http.StatusOK, popResponse{deletedUserId})
+}
+
+func (a *AdminApi) ack(w http.ResponseWriter, r *http.Request) {
+	req, ok := a.readUserRequest(w, r)
+	if !ok {
+		return
+	}
+	a.writeResult(w, a.queueService.Ack(req.UserId))
+}
+
+func (a *AdminApi) clean(w http.ResponseWriter, r *http.Request) {
+	a.writeResult(w, a.queueService.DeleteAll(r.Header.Get(authorHeader)))
+}
+
+func (a *AdminApi) showDeadLetters(w http.ResponseWriter, r *http.Request) {
+	messages, err := a.deadLetters.DeadLetters()
+	if err != nil {
+		writeErr(w, a.logger, err)
+		return
+	}
+	if messages == nil {
+		messages = []outbox.Message{}
+	}
+	writeJson(w, http.StatusOK, messages)
+}
+
+func (a *AdminApi) showEventFailures(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, a.eventFailures.Failures())
+}
+
+func (a *AdminApi) showRejectedCommands(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, a.rejected.Rejected())
+}
+
+func (a *AdminApi) readUserRequest(w http.ResponseWriter, r *http.Request) (userRequest, bool) {
+	req := userRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, http.StatusBadRequest, errorResponse{"can't parse body: " + err.Error()})
+		return req, false
+	}
+	if req.UserId == "" {
+		writeJson(w, http.StatusBadRequest, errorResponse{"user_id is required"})
+		return req, false
+	}
+	return req, true
+}
+
+//writeResult answers with the queue after a successful action
+func (a *AdminApi) writeResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeErr(w, a.logger, err)
+		return
+	}
+	a.writeQueue(w)
+}
+
+func (a *AdminApi) writeQueue(w http.ResponseWriter) {
+	q, err := a.queueService.Show()
+	if err != nil {
+		writeErr(w, a.logger, err)
+		return
+	}
+	if q.Entities == nil {
+		q.Entities = []model.QueueEntity{}
+	}
+	writeJson(w, http.StatusOK, q)
+}
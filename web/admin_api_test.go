@@ -0,0 +1,136 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	eventmock "github.com/yonesko/slack-queue-bot/event/mock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/outbox"
+	"github.com/yonesko/slack-queue-bot/preference"
+	queuemock "github.com/yonesko/slack-queue-bot/queue/mock"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"github.com/yonesko/slack-queue-bot/usecase/impl"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminApi_unauthorized(t *testing.T) {
+	mux, _ := mockAdminApi(model.Queue{})
+	recorder := doRequest(mux, http.MethodGet, "/api/queue", "wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestAdminApi_wrong_method(t *testing.T) {
+	mux, _ := mockAdminApi(model.Queue{})
+	recorder := doRequest(mux, http.MethodGet, "/api/queue/clean", "secret", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestAdminApi_add_and_show(t *testing.T) {
+	mux, _ := mockAdminApi(model.Queue{})
+	recorder := doRequest(mux, http.MethodPost, "/api/queue/add", "secret", `{"user_id": "1"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = doRequest(mux, http.MethodPost, "/api/queue/add", "secret", `{"user_id": "1"}`)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, `{"error":"already exist"}`, strings.TrimSpace(recorder.Body.String()))
+
+	recorder = doRequest(mux, http.MethodGet, "/api/queue", "secret", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	q := model.Queue{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &q))
+	assert.Equal(t, []model.QueueEntity{{UserId: "1"}}, q.Entities)
+}
+
+func TestAdminApi_delete(t *testing.T) {
+	mux, bus := mockAdminApi(model.Queue{Entities: []model.QueueEntity{{UserId: "1"}, {UserId: "2"}}})
+	recorder := doRequest(mux, http.MethodDelete, "/api/queue/entities/3", "secret", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = doRequest(mux, http.MethodDelete, "/api/queue/entities/2", "secret", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, bus.Inbox, model.DeletedEvent{AuthorUserId: "admin", DeletedUserId: "2"})
+}
+
+func TestAdminApi_pop_and_clean(t *testing.T) {
+	mux, _ := mockAdminApi(model.Queue{Entities: []model.QueueEntity{{UserId: "1"}, {UserId: "2"}, {UserId: "3"}}})
+	recorder := doRequest(mux, http.MethodPost, "/api/queue/pop", "secret", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `{"deleted_user_id":"1"}`, strings.TrimSpace(recorder.Body.String()))
+	recorder = doRequest(mux, http.MethodPost, "/api/queue/clean", "secret", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = doRequest(mux, http.MethodPost, "/api/queue/clean", "secret", "")
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestAdminApi_pass_bad_request(t *testing.T) {
+	mux, _ := mockAdminApi(model.Queue{Entities: []model.QueueEntity{{UserId: "1"}}})
+	recorder := doRequest(mux, http.MethodPost, "/api/queue/pass", "secret", `{}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = doRequest(mux, http.MethodPost, "/api/queue/pass", "secret", `{"user_id": "1"}`)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func doRequest(mux *http.ServeMux, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(authorHeader, "admin")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAdminApi_dead_letters(t *testing.T) {
+	mux, _ := mockAdminApi(model.Queue{})
+	recorder := doRequest(mux, http.MethodGet, "/api/outbox/dead", "secret", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var messages []outbox.Message
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &messages))
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "channel_not_found", messages[0].LastError)
+}
+
+func TestAdminApi_event_failures(t *testing.T) {
+	mux, _ := mockAdminApi(model.Queue{})
+	recorder := doRequest(mux, http.MethodGet, "/api/events/failures", "secret", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"webhooks": 2, "dashboard": 0}`, recorder.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, doRequest(mux, http.MethodGet, "/api/events/failures", "wrong", "").Code)
+}
+
+func TestAdminApi_rejected_commands(t *testing.T) {
+	mux, _ := mockAdminApi(model.Queue{})
+	recorder := doRequest(mux, http.MethodGet, "/api/commands/rejected", "secret", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"U1": 7}`, recorder.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, doRequest(mux, http.MethodGet, "/api/commands/rejected", "wrong", "").Code)
+}
+
+type eventFailuresMock map[string]int
+
+func (m eventFailuresMock) Failures() map[string]int {
+	return m
+}
+
+type rejectedCommandsMock map[string]int
+
+func (m rejectedCommandsMock) Rejected() map[string]int {
+	return m
+}
+
+func mockAdminApi(queue model.Queue) (*http.ServeMux, *eventmock.QueueChangedEventBus) {
+	i18n.TestInit()
+	bus := &eventmock.QueueChangedEventBus{}
+	queueService := impl.NewQueueService(&queuemock.QueueRepository{Queue: queue}, bus, gateway.Mock{}, preference.NewLocalizerMock(), time.Minute*7, usecase.NotifyAbsent, clock.New())
+	mux := http.NewServeMux()
+	deadLetters := gateway.NewOutboxGateway(ioutil.Discard, gateway.Mock{}, &outbox.RepositoryMock{Outbox: outbox.Outbox{
+		Dead: []outbox.Message{{Id: "1", UserId: "2", Text: "your turn", Attempts: 10, LastError: "channel_not_found"}},
+	}}, 0, clock.New())
+	NewAdminApi(ioutil.Discard, queueService, deadLetters, eventFailuresMock{"webhooks": 2, "dashboard": 0}, rejectedCommandsMock{"U1": 7}, "secret").Register(mux)
+	return mux, bus
+}
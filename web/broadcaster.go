@@ -0,0 +1,40 @@
+package web
+
+import "sync"
+
+//Broadcaster wakes up every subscribed client when the queue changes
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: map[chan struct{}]struct{}{}}
+}
+
+func (b *Broadcaster) Fire(event interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			//subscriber has a pending notification already
+		}
+	}
+}
+
+//Subscribe returns a channel receiving a notification when the queue changes, notifications not read yet are coalesced
+func (b *Broadcaster) Subscribe() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *Broadcaster) Unsubscribe(ch chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, ch)
+}
@@ -0,0 +1,129 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/preference"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"io"
+	"log"
+	"net/http"
+)
+
+const outcomeStarted = "started"
+
+//CiWebhook lets a pipeline release the queue when a deploy is done
+type CiWebhook struct {
+	queueService usecase.QueueService
+	gateway      gateway.Gateway
+	localizer    preference.Localizer
+	token        string
+	queueName    string
+	logger       *log.Logger
+}
+
+func NewCiWebhook(lumberWriter io.Writer, queueService usecase.QueueService, gateway gateway.Gateway, localizer preference.Localizer, token string, queueName string) *CiWebhook {
+	return &CiWebhook{
+		queueService: queueService,
+		gateway:      gateway,
+		localizer:    localizer,
+		token:        token,
+		queueName:    queueName,
+		logger:       log.New(lumberWriter, "ci-webhook: ", log.Lshortfile|log.LstdFlags),
+	}
+}
+
+func (c *CiWebhook) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/ci", c.handle)
+}
+
+type ciRequest struct {
+	//UserId of the holder, if empty the current holder of Queue is used
+	UserId  string `json:"user_id"`
+	Queue   string `json:"queue"`
+	Outcome string `json:"outcome"`
+	Url     string `json:"url"`
+}
+
+func (c *CiWebhook) handle(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPost, c.token) {
+		return
+	}
+	req := ciRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, http.StatusBadRequest, errorResponse{"can't parse body: " + err.Error()})
+		return
+	}
+	c.logger.Printf("received %#v", req)
+	if req.Outcome == "" || (req.UserId == "" && req.Queue == "") {
+		writeJson(w, http.StatusBadRequest, errorResponse{"outcome and one of user_id or queue are required"})
+		return
+	}
+	if req.Queue != "" && req.Queue != c.queueName {
+		writeJson(w, http.StatusNotFound, errorResponse{fmt.Sprintf("unknown queue %s", req.Queue)})
+		return
+	}
+	var err error
+	if req.Outcome == outcomeStarted {
+		err = c.start(req)
+	} else {
+		err = c.finish(req)
+	}
+	if err != nil {
+		writeErr(w, c.logger, err)
+		return
+	}
+	q, err := c.queueService.Show()
+	if err != nil {
+		writeErr(w, c.logger, err)
+		return
+	}
+	writeJson(w, http.StatusOK, q)
+}
+
+func (c *CiWebhook) holder(req ciRequest) (string, error) {
+	q, err := c.queueService.Show()
+	if err != nil {
+		return "", err
+	}
+	if q.CurHolder() == "" {
+		return "", usecase.QueueIsEmpty
+	}
+	if req.UserId != "" && req.UserId != q.CurHolder() {
+		return "", usecase.YouAreNotHolder
+	}
+	return q.CurHolder(), nil
+}
+
+//start marks the hold as actively in use, so it isn't passed while the holder is away
+func (c *CiWebhook) start(req ciRequest) error {
+	holder, err := c.holder(req)
+	if err != nil {
+		return err
+	}
+	err = c.queueService.Ack(holder)
+	if err == usecase.HolderIsNotSleeping {
+		return nil
+	}
+	return err
+}
+
+//finish releases the queue, the holder is checked and deleted in one step, so a concurrent change can't be deleted by mistake
+func (c *CiWebhook) finish(req ciRequest) error {
+	holder, err := c.queueService.Release(req.UserId, req.Outcome)
+	if err != nil {
+		return err
+	}
+	//the outcome comes from CI, it is escaped so it can't mention anyone
+	outcome := gateway.Escape(req.Outcome)
+	if req.Url != "" {
+		outcome = fmt.Sprintf("<%s|%s>", gateway.Escape(req.Url), outcome)
+	}
+	markup := c.localizer.Labels(holder).Format("ci_pipeline_finished", i18n.Params{"outcome": outcome})
+	if err := c.gateway.SendMarkup(holder, markup); err != nil {
+		c.logger.Printf("can't tell %s the pipeline outcome: %s", holder, err)
+	}
+	return nil
+}
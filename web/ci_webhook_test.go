@@ -0,0 +1,106 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	eventmock "github.com/yonesko/slack-queue-bot/event/mock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	queuemock "github.com/yonesko/slack-queue-bot/queue/mock"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"github.com/yonesko/slack-queue-bot/usecase/impl"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCiWebhook_finish_by_user(t *testing.T) {
+	mux, bus := mockCiWebhook(model.Queue{Entities: []model.QueueEntity{{UserId: "1"}, {UserId: "2"}}})
+	recorder := doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"user_id": "1", "outcome": "success"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	q := model.Queue{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &q))
+	assert.Equal(t, []model.QueueEntity{{UserId: "2"}}, q.Entities)
+	for _, e := range bus.Inbox {
+		_, isDeleted := e.(model.DeletedEvent)
+		assert.False(t, isDeleted, "holder releases the queue by himself")
+	}
+	assert.Contains(t, bus.Inbox, model.ReleasedEvent{
+		QueueOperation: model.QueueOperation{AuthorUserId: "1", Queue: []string{"2"}, Positions: []model.PositionChange{{"2", 1, 0}, {"1", 0, -1}}, Ts: ciTime},
+		ReleasedUserId: "1",
+		Outcome:        "success",
+	})
+}
+
+//markupGateway records markup sent to users
+type markupGateway struct {
+	gateway.Mock
+	sent map[string]string
+}
+
+func (g *markupGateway) SendMarkup(userId, markup string) error {
+	g.sent[userId] = markup
+	return nil
+}
+
+func TestCiWebhook_finish_with_url(t *testing.T) {
+	i18n.InitFrom("../i18n", "english")
+	queueService := impl.NewQueueService(&queuemock.QueueRepository{Queue: model.Queue{Entities: []model.QueueEntity{{UserId: "1"}}}},
+		&eventmock.QueueChangedEventBus{}, gateway.Mock{}, preference.NewLocalizerMock(), time.Minute*7, usecase.NotifyAbsent, clock.New())
+	g := &markupGateway{sent: map[string]string{}}
+	mux := http.NewServeMux()
+	NewCiWebhook(ioutil.Discard, queueService, g, preference.NewLocalizerMock(), "ci-secret", "staging").Register(mux)
+
+	recorder := doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"user_id": "1", "outcome": "failed <!here>", "url": "https://ci/p?a=1&b=2"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "Pipeline has finished: <https://ci/p?a=1&amp;b=2|failed &lt;!here&gt;>. You are deleted from the queue", g.sent["1"],
+		"the outcome is a link, CI input can't mention anyone")
+}
+
+func TestCiWebhook_finish_by_queue(t *testing.T) {
+	mux, _ := mockCiWebhook(model.Queue{Entities: []model.QueueEntity{{UserId: "1"}, {UserId: "2"}}})
+	recorder := doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"queue": "staging", "outcome": "failed"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"queue": "prod", "outcome": "failed"}`)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCiWebhook_not_holder(t *testing.T) {
+	mux, _ := mockCiWebhook(model.Queue{Entities: []model.QueueEntity{{UserId: "1"}, {UserId: "2"}}})
+	recorder := doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"user_id": "2", "outcome": "success"}`)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestCiWebhook_started(t *testing.T) {
+	mux, _ := mockCiWebhook(model.Queue{Entities: []model.QueueEntity{{UserId: "1"}}, HolderIsSleeping: true})
+	recorder := doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"user_id": "1", "outcome": "started"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	q := model.Queue{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &q))
+	assert.False(t, q.HolderIsSleeping)
+	recorder = doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"user_id": "1", "outcome": "started"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestCiWebhook_bad_request(t *testing.T) {
+	mux, _ := mockCiWebhook(model.Queue{})
+	assert.Equal(t, http.StatusBadRequest, doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"user_id": "1"}`).Code)
+	assert.Equal(t, http.StatusConflict, doRequest(mux, http.MethodPost, "/api/ci", "ci-secret", `{"queue": "staging", "outcome": "success"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, doRequest(mux, http.MethodPost, "/api/ci", "secret", `{}`).Code)
+}
+
+//ciTime is when requests of CI come
+var ciTime = time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC)
+
+func mockCiWebhook(queue model.Queue) (*http.ServeMux, *eventmock.QueueChangedEventBus) {
+	i18n.TestInit()
+	bus := &eventmock.QueueChangedEventBus{}
+	queueService := impl.NewQueueService(&queuemock.QueueRepository{Queue: queue}, bus, gateway.Mock{}, preference.NewLocalizerMock(), time.Minute*7, usecase.NotifyAbsent, clock.NewFake(ciTime))
+	mux := http.NewServeMux()
+	NewCiWebhook(ioutil.Discard, queueService, gateway.Mock{}, preference.NewLocalizerMock(), "ci-secret", "staging").Register(mux)
+	return mux, bus
+}
@@ -0,0 +1,242 @@
+package web
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/estimate"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"github.com/yonesko/slack-queue-bot/user"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//refreshInterval keeps hold durations and ETAs fresh when nothing happens to the queue
+const refreshInterval = time.Minute
+
+type Dashboard struct {
+	queueService       usecase.QueueService
+	userRepository     user.Repository
+	estimateRepository estimate.Repository
+	broadcaster        *Broadcaster
+	logger             *log.Logger
+	clock              clock.Clock
+	templates          *template.Template
+	//token is the dashboard token, if empty the dashboard is shown to local clients only
+	token string
+}
+
+func NewDashboard(lumberWriter io.Writer, queueService usecase.QueueService, userRepository user.Repository, estimateRepository estimate.Repository, broadcaster *Broadcaster, token string, clock clock.Clock) *Dashboard {
+	return &Dashboard{
+		queueService:       queueService,
+		userRepository:     userRepository,
+		estimateRepository: estimateRepository,
+		broadcaster:        broadcaster,
+		logger:             log.New(lumberWriter, "dashboard: ", log.Lshortfile|log.LstdFlags),
+		clock:              clock,
+		templates:          template.Must(template.New("dashboard").Parse(dashboardTemplates)),
+		token:              token,
+	}
+}
+
+func (d *Dashboard) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/", d.auth(d.index))
+	mux.HandleFunc("/events", d.auth(d.events))
+}
+
+//auth lets in requests with the dashboard token in the token query parameter or the Authorization header,
+//without the dashboard token only requests from the loopback interface are let in
+func (d *Dashboard) auth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !d.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (d *Dashboard) authorized(r *http.Request) bool {
+	if d.token == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return false
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	got := r.URL.Query().Get("token")
+	if got == "" {
+		got = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(d.token)) == 1
+}
+
+//queueView is shown to everyone, so it is in the bot language
+type queueView struct {
+	Entities []entityView
+	EmptyTxt string
+	//Token is passed on to the events stream, EventSource can't send headers
+	Token string
+}
+
+type entityView struct {
+	Position     int
+	FullName     string
+	DisplayName  string
+	HoldDuration string
+	SleepingTxt  string
+	Eta          string
+}
+
+func (d *Dashboard) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	view, err := d.buildView()
+	if err != nil {
+		d.logger.Printf("can't build view: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	view.Token = r.URL.Query().Get("token")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := d.templates.ExecuteTemplate(w, "page", view); err != nil {
+		d.logger.Printf("can't render page: %s", err)
+	}
+}
+
+//events streams the rendered queue with Server-Sent Events
+func (d *Dashboard) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	changes := d.broadcaster.Subscribe()
+	defer d.broadcaster.Unsubscribe(changes)
+	ticker := d.clock.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.push(w); err != nil {
+			d.logger.Printf("can't push queue: %s", err)
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changes:
+		case <-ticker.C():
+		}
+	}
+}
+
+func (d *Dashboard) push(w io.Writer) error {
+	view, err := d.buildView()
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := d.templates.ExecuteTemplate(buf, "queue", view); err != nil {
+		return err
+	}
+	msg := "event: queue\n"
+	for _, line := range strings.Split(buf.String(), "\n") {
+		msg += "data: " + line + "\n"
+	}
+	_, err = io.WriteString(w, msg+"\n")
+	return err
+}
+
+func (d *Dashboard) buildView() (queueView, error) {
+	q, err := d.queueService.Show()
+	if err != nil {
+		return queueView{}, err
+	}
+	view := queueView{EmptyTxt: i18n.L.MustGet("queue_is_empty")}
+	for i, e := range q.Entities {
+		u, err := d.userRepository.FindById(e.UserId)
+		if err != nil {
+			return queueView{}, fmt.Errorf("can't buildView: %s", err)
+		}
+		entity := entityView{Position: i + 1, FullName: u.FullName, DisplayName: u.DisplayName}
+		if i == 0 {
+			if q.HoldTs.Unix() > 0 {
+				entity.HoldDuration = formatDuration(d.clock.Now().Sub(q.HoldTs))
+			}
+			if q.HolderIsSleeping {
+				entity.SleepingTxt = i18n.L.MustGet("dashboard_sleeping")
+			}
+		} else {
+			entity.Eta = d.etaTxt(i, q)
+		}
+		view.Entities = append(view.Entities, entity)
+	}
+	return view, nil
+}
+
+func (d *Dashboard) etaTxt(i int, queue model.Queue) string {
+	estimate, err := d.estimateRepository.Read()
+	if err != nil {
+		d.logger.Printf("can't get estimate %s", err)
+		return ""
+	}
+	duration := estimate.TimeToWait(uint(i), queue.HoldTs, d.clock.Now())
+	if duration < time.Minute {
+		return ""
+	}
+	return fmt.Sprintf("~%s (%s)", formatDuration(duration), d.clock.Now().Add(duration).Format("15:04"))
+}
+
+func formatDuration(duration time.Duration) string {
+	if duration < time.Minute {
+		return "<1m"
+	}
+	return strings.TrimSuffix(duration.Round(time.Minute).String(), "0s")
+}
+
+const dashboardTemplates = `
+{{define "page"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>slack-queue-bot</title>
+<style>
+body { font-family: sans-serif; font-size: 2em; margin: 2em; }
+td { padding: 0.2em 1em; }
+.holder { font-weight: bold; }
+.muted { color: gray; }
+</style>
+</head>
+<body>
+<div id="queue">{{template "queue" .}}</div>
+<script>
+new EventSource("events{{if .Token}}?token={{.Token}}{{end}}").addEventListener("queue", function (e) {
+	document.getElementById("queue").innerHTML = e.data;
+});
+</script>
+</body>
+</html>
+{{end}}
+{{define "queue"}}{{if .Entities}}<table>
+{{range .Entities}}<tr{{if eq .Position 1}} class="holder"{{end}}>
+<td>{{.Position}}</td>
+<td>{{.FullName}} <span class="muted">({{.DisplayName}})</span></td>
+<td>{{if .HoldDuration}}&#128274; {{.HoldDuration}}{{end}}{{if .SleepingTxt}} &#128564; {{.SleepingTxt}}{{end}}{{if .Eta}}<span class="muted">{{.Eta}}</span>{{end}}</td>
+</tr>
+{{end}}</table>{{else}}<p>{{.EmptyTxt}}</p>{{end}}{{end}}
+`
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yonesko/slack-queue-bot/clock"
+	"github.com/yonesko/slack-queue-bot/estimate"
+	eventmock "github.com/yonesko/slack-queue-bot/event/mock"
+	"github.com/yonesko/slack-queue-bot/gateway"
+	"github.com/yonesko/slack-queue-bot/i18n"
+	"github.com/yonesko/slack-queue-bot/model"
+	"github.com/yonesko/slack-queue-bot/preference"
+	queuemock "github.com/yonesko/slack-queue-bot/queue/mock"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"github.com/yonesko/slack-queue-bot/usecase/impl"
+	usermock "github.com/yonesko/slack-queue-bot/user/mock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard_index(t *testing.T) {
+	fake := clock.NewFake(time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC))
+	dashboard := mockDashboard(model.Queue{
+		Entities:         []model.QueueEntity{{UserId: "1"}, {UserId: "2"}},
+		HoldTs:           fake.Now().Add(-time.Minute * 90),
+		HolderIsSleeping: true,
+	})
+	dashboard.clock = fake
+	recorder := httptest.NewRecorder()
+	dashboard.index(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, "Gleb Bukin")
+	assert.Contains(t, body, "(glebone)")
+	assert.Contains(t, body, "Ivan Ivanov")
+	assert.Contains(t, body, "1h30m")
+	assert.Contains(t, body, "sleeping")
+
+	fake.Advance(time.Minute)
+	recorder = httptest.NewRecorder()
+	dashboard.index(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, recorder.Body.String(), "1h31m", "hold time counts by the clock")
+}
+
+func TestDashboard_index_empty(t *testing.T) {
+	dashboard := mockDashboard(model.Queue{})
+	recorder := httptest.NewRecorder()
+	dashboard.index(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, recorder.Body.String(), "Queue is empty")
+}
+
+func TestDashboard_events_pushes_on_change(t *testing.T) {
+	dashboard := mockDashboard(model.Queue{Entities: []model.QueueEntity{{UserId: "1"}}})
+	server := httptest.NewServer(http.HandlerFunc(dashboard.events))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	buf := make([]byte, 4096)
+	n, err := resp.Body.Read(buf)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(buf[:n]), "event: queue\ndata: "))
+	assert.Contains(t, string(buf[:n]), "Gleb Bukin")
+
+	dashboard.broadcaster.Fire(model.DeletedEvent{})
+	n, err = resp.Body.Read(buf)
+	assert.Nil(t, err)
+	assert.Contains(t, string(buf[:n]), "event: queue")
+}
+
+func TestDashboard_auth(t *testing.T) {
+	dashboard := mockDashboard(model.Queue{})
+	mux := http.NewServeMux()
+	dashboard.Register(mux)
+	serve := func(target string, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		return recorder
+	}
+	assert.Equal(t, http.StatusUnauthorized, serve("/", "127.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("/?token=wrong", "127.0.0.1:1234").Code)
+	recorder := serve("/?token=secret", "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "events?token=secret")
+
+	dashboard.token = ""
+	assert.Equal(t, http.StatusUnauthorized, serve("/", "10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusOK, serve("/", "127.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusOK, serve("/", "[::1]:1234").Code)
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "<1m", formatDuration(time.Second*30))
+	assert.Equal(t, "5m", formatDuration(time.Minute*5))
+	assert.Equal(t, "3h5m", formatDuration(time.Hour*3+time.Minute*5))
+	assert.Equal(t, "2h0m", formatDuration(time.Hour*2))
+}
+
+func mockDashboard(queue model.Queue) *Dashboard {
+	i18n.InitFrom("../i18n", "english")
+	queueService := impl.NewQueueService(&queuemock.QueueRepository{Queue: queue}, &eventmock.QueueChangedEventBus{}, gateway.Mock{}, preference.NewLocalizerMock(), time.Minute*7, usecase.NotifyAbsent, clock.New())
+	userRepository := usermock.NewUserRepository(map[string]model.User{
+		"1": {Id: "1", FullName: "Gleb Bukin", DisplayName: "glebone"},
+		"2": {Id: "2", FullName: "Ivan Ivanov", DisplayName: "ivan"},
+	})
+	return NewDashboard(ioutil.Discard, queueService, userRepository, &estimate.RepositoryMock{}, NewBroadcaster(), "secret", clock.New())
+}
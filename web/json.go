@@ -0,0 +1,56 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/yonesko/slack-queue-bot/usecase"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+//authorize checks bearer token and method, answers with an error if they don't match
+func authorize(w http.ResponseWriter, r *http.Request, method string, token string) bool {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		writeJson(w, http.StatusUnauthorized, errorResponse{"invalid token"})
+		return false
+	}
+	if r.Method != method {
+		writeJson(w, http.StatusMethodNotAllowed, errorResponse{"method not allowed"})
+		return false
+	}
+	return true
+}
+
+func writeErr(w http.ResponseWriter, logger *log.Logger, err error) {
+	status := errStatus(err)
+	if status == http.StatusInternalServerError {
+		logger.Println(err)
+	}
+	writeJson(w, status, errorResponse{err.Error()})
+}
+
+func errStatus(err error) int {
+	switch err {
+	case usecase.NoSuchUserErr:
+		return http.StatusNotFound
+	case usecase.AlreadyExistErr, usecase.QueueIsEmpty, usecase.NoOneToPass, usecase.HolderIsNotSleeping:
+		return http.StatusConflict
+	case usecase.YouAreNotHolder:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("can't write json: %s", err)
+	}
+}